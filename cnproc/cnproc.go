@@ -0,0 +1,142 @@
+// Package cnproc reads process events from the Linux proc connector, a
+// netlink multicast group the kernel reports every fork, exec and exit to.
+package cnproc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Event types, as the kernel's enum proc_cn_event. Other events (uid, comm,
+// ptrace...) are dropped by ParseMessages.
+const (
+	EventFork = "fork"
+	EventExec = "exec"
+	EventExit = "exit"
+)
+
+const (
+	procEventFork = 0x00000001
+	procEventExec = 0x00000002
+	procEventExit = 0x80000000
+
+	nlmsgHdrLen   = 16
+	cnMsgLen      = 20
+	procEventLen  = 16
+	nlmsgDone     = 3
+	cnIdxProc     = 1
+	cnValProc     = 1
+	procCnListen  = 1
+	procCnIgnore  = 2
+	nlmsgAlignTo  = 4
+	maxMessageLen = 4096
+)
+
+// Event is a single process event. Pid and Tgid are the process the event is
+// about (the child for forks); ParentPid and ParentTgid are only set for
+// forks. Threads show up as events with Pid != Tgid. Timestamp is in
+// nanoseconds since boot.
+type Event struct {
+	Type       string
+	Pid        int
+	Tgid       int
+	ParentPid  int
+	ParentTgid int
+	ExitCode   int
+	Timestamp  uint64
+}
+
+// IsThread reports whether the event is about a thread rather than a
+// process.
+func (e Event) IsThread() bool {
+	return e.Pid != e.Tgid
+}
+
+// Source is a stream of process events. Next blocks until events are
+// available and returns an error once the source is closed.
+type Source interface {
+	Next() ([]Event, error)
+	Close() error
+}
+
+// ErrLost is returned by Source.Next when events were dropped because they
+// weren't read fast enough. The source stays usable.
+var ErrLost = errors.New("cnproc: events lost")
+
+func errMalformed() error {
+	return fmt.Errorf("cnproc: malformed message")
+}
+
+func nlmsgAlign(length int) int {
+	return (length + nlmsgAlignTo - 1) &^ (nlmsgAlignTo - 1)
+}
+
+// ParseMessages parses a datagram read from the connector socket, which may
+// hold several netlink messages. The connector speaks host byte order; like
+// the rest of the agent this assumes a little-endian host.
+func ParseMessages(data []byte) ([]Event, error) {
+	var events []Event
+
+	for len(data) >= nlmsgHdrLen {
+		msgLen := (int)(binary.LittleEndian.Uint32(data[0:]))
+		if msgLen < nlmsgHdrLen || msgLen > len(data) {
+			return events, errMalformed()
+		}
+		msg := data[nlmsgHdrLen:msgLen]
+		if next := nlmsgAlign(msgLen); next < len(data) {
+			data = data[next:]
+		} else {
+			data = nil
+		}
+
+		if len(msg) < cnMsgLen+procEventLen {
+			continue
+		}
+		if binary.LittleEndian.Uint32(msg[0:]) != cnIdxProc || binary.LittleEndian.Uint32(msg[4:]) != cnValProc {
+			continue
+		}
+		payload := msg[cnMsgLen:]
+		what := binary.LittleEndian.Uint32(payload[0:])
+		event := Event{Timestamp: binary.LittleEndian.Uint64(payload[8:])}
+		body := payload[procEventLen:]
+		field := func(i int) int {
+			if len(body) < 4*(i+1) {
+				return 0
+			}
+			return (int)(int32(binary.LittleEndian.Uint32(body[4*i:])))
+		}
+
+		switch what {
+		case procEventFork:
+			event.Type = EventFork
+			event.ParentPid, event.ParentTgid = field(0), field(1)
+			event.Pid, event.Tgid = field(2), field(3)
+		case procEventExec:
+			event.Type = EventExec
+			event.Pid, event.Tgid = field(0), field(1)
+		case procEventExit:
+			event.Type = EventExit
+			event.Pid, event.Tgid = field(0), field(1)
+			event.ExitCode = field(2)
+		default:
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// listenMessage is the netlink message that subscribes to (or, with
+// procCnIgnore, unsubscribes from) the proc connector.
+func listenMessage(op uint32) []byte {
+	msg := make([]byte, nlmsgHdrLen+cnMsgLen+4)
+	binary.LittleEndian.PutUint32(msg[0:], (uint32)(len(msg)))
+	binary.LittleEndian.PutUint16(msg[4:], nlmsgDone)
+	binary.LittleEndian.PutUint32(msg[nlmsgHdrLen:], cnIdxProc)
+	binary.LittleEndian.PutUint32(msg[nlmsgHdrLen+4:], cnValProc)
+	binary.LittleEndian.PutUint16(msg[nlmsgHdrLen+16:], 4)
+	binary.LittleEndian.PutUint32(msg[nlmsgHdrLen+cnMsgLen:], op)
+	return msg
+}
@@ -0,0 +1,51 @@
+package cnproc
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// message builds a netlink message carrying a proc connector event, padded
+// to the netlink alignment like the kernel does.
+func message(what uint32, fields ...uint32) []byte {
+	msg := make([]byte, nlmsgHdrLen+cnMsgLen+procEventLen+4*len(fields))
+	binary.LittleEndian.PutUint32(msg[0:], (uint32)(len(msg)))
+	binary.LittleEndian.PutUint32(msg[nlmsgHdrLen:], cnIdxProc)
+	binary.LittleEndian.PutUint32(msg[nlmsgHdrLen+4:], cnValProc)
+	event := msg[nlmsgHdrLen+cnMsgLen:]
+	binary.LittleEndian.PutUint32(event[0:], what)
+	binary.LittleEndian.PutUint64(event[8:], 42)
+	for i, field := range fields {
+		binary.LittleEndian.PutUint32(event[procEventLen+4*i:], field)
+	}
+	return append(msg, make([]byte, nlmsgAlign(len(msg))-len(msg))...)
+}
+
+func TestParseMessages(t *testing.T) {
+	var data []byte
+	data = append(data, message(procEventFork, 100, 100, 200, 200)...)
+	data = append(data, message(procEventExec, 200, 200)...)
+	data = append(data, message(0x200, 200, 200)...)
+	data = append(data, message(procEventExit, 201, 200, 256, 17)...)
+
+	events, err := ParseMessages(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Event{
+		{Type: EventFork, Pid: 200, Tgid: 200, ParentPid: 100, ParentTgid: 100, Timestamp: 42},
+		{Type: EventExec, Pid: 200, Tgid: 200, Timestamp: 42},
+		{Type: EventExit, Pid: 201, Tgid: 200, ExitCode: 256, Timestamp: 42},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("got %+v, want %+v", events, want)
+	}
+	if !events[2].IsThread() {
+		t.Error("expected the exit of a thread")
+	}
+
+	if _, err := ParseMessages(data[:20]); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
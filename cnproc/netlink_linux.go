@@ -0,0 +1,57 @@
+package cnproc
+
+import (
+	"syscall"
+)
+
+// NetlinkSource reads events from the kernel. It needs CAP_NET_ADMIN in the
+// host's network namespace.
+type NetlinkSource struct {
+	fd  int
+	buf []byte
+}
+
+// Listen subscribes to the proc connector.
+func Listen() (*NetlinkSource, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: cnIdxProc})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	err = syscall.Sendto(fd, listenMessage(procCnListen), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	return &NetlinkSource{fd: fd, buf: make([]byte, maxMessageLen)}, nil
+}
+
+// Next returns the events of the next datagram. When the socket had to drop
+// datagrams because the agent didn't keep up it returns ErrLost.
+func (s *NetlinkSource) Next() ([]Event, error) {
+	for {
+		n, _, err := syscall.Recvfrom(s.fd, s.buf, 0)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.ENOBUFS {
+			return nil, ErrLost
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ParseMessages(s.buf[:n])
+	}
+}
+
+func (s *NetlinkSource) Close() error {
+	syscall.Sendto(s.fd, listenMessage(procCnIgnore), 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+	return syscall.Close(s.fd)
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package cnproc
+
+import (
+	"fmt"
+)
+
+type NetlinkSource struct{}
+
+// Listen fails, the proc connector is Linux only.
+func Listen() (*NetlinkSource, error) {
+	return nil, fmt.Errorf("cnproc: the proc connector needs Linux")
+}
+
+func (s *NetlinkSource) Next() ([]Event, error) {
+	return nil, fmt.Errorf("cnproc: the proc connector needs Linux")
+}
+
+func (s *NetlinkSource) Close() error {
+	return nil
+}
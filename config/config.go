@@ -0,0 +1,61 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+)
+
+// Config is the agent's configuration. It is read from a JSON file, and
+// flags given on the command line override what the file sets.
+type Config struct {
+	// HostRoot is where the host's /proc, /sys/fs/cgroup and runtime
+	// state directories are mounted into the agent's container.
+	HostRoot string `json:"hostRoot"`
+	// OutputDir is where every Monitoring() run writes its results for the
+	// HTTP API to serve.
+	OutputDir string `json:"outputDir"`
+	// ProcConnector subscribes to the kernel's proc connector for fork,
+	// exec and exit events between Monitoring() runs. It needs
+	// CAP_NET_ADMIN and the host's network namespace.
+	ProcConnector bool `json:"procConnector"`
+	// CaptureEnviron adds the environment of every process to the process
+	// info.
+	CaptureEnviron bool `json:"captureEnviron"`
+	// RedactPatterns are the names of environment variables and arguments
+	// whose values are masked, as shell globs (e.g. "*TOKEN*"). Unset keeps
+	// the agent's defaults, an empty list disables redaction.
+	RedactPatterns []string `json:"redactPatterns"`
+	// CriEndpoint is the CRI socket on the host, as a path or unix:// URL,
+	// container metadata is asked from. Unset asks the sockets of every
+	// runtime found on the node.
+	CriEndpoint string `json:"criEndpoint"`
+	// Kubernetes watches the pods of the node, named by CSA_NODE_NAME,
+	// through the API server with the pod's service account, to attribute
+	// containers to the workloads managing them.
+	Kubernetes bool `json:"kubernetes"`
+}
+
+func Default() Config {
+	return Config{
+		HostRoot:  "/rootfs",
+		OutputDir: "/dist",
+	}
+}
+
+// Load reads filePath over the defaults, so the file only has to set what
+// differs from them.
+func Load(filePath string) (Config, error) {
+	cfg := Default()
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return cfg, err
+	}
+
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,220 @@
+// Package cri is a client of the Kubernetes Container Runtime Interface
+// (runtime.v1) served by containerd, cri-o and cri-dockerd on a unix
+// socket. It only reads: the agent asks the runtime what the kubelet told
+// it about each container.
+package cri
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// DefaultTimeout bounds connecting, Version, and a whole Containers
+// listing.
+const DefaultTimeout = 5 * time.Second
+
+// restartCountAnnotation is set by the kubelet on every container. The
+// attempt number of the metadata is the same thing, but only annotations
+// survive a runtime restart on every runtime.
+const restartCountAnnotation = "io.kubernetes.container.restartCount"
+
+// Container is a running container as the runtime knows it, with the pod of
+// its sandbox. ImageRef is the image the runtime resolved Image to, usually
+// its digest. Sandboxes themselves (the pause containers) are listed too,
+// with Sandbox set and no Name.
+type Container struct {
+	Id           string
+	SandboxId    string
+	Sandbox      bool
+	Name         string
+	PodName      string
+	PodNamespace string
+	PodUid       string
+	Image        string
+	ImageRef     string
+	Labels       map[string]string
+	Annotations  map[string]string
+	RestartCount int
+}
+
+// Client talks to a single runtime. It remembers the status of the
+// containers and sandboxes it listed, which don't change for a given ID,
+// so a client kept around only asks about new ones. It is not safe for
+// concurrent use.
+type Client struct {
+	conn       *grpc.ClientConn
+	runtime    runtimeapi.RuntimeServiceClient
+	timeout    time.Duration
+	containers map[string]Container
+	sandboxes  map[string]*runtimeapi.PodSandboxStatus
+}
+
+// Dial connects to the runtime listening on socket. It fails right away if
+// there is no socket or nobody listens on it, and within timeout if nothing
+// answers.
+func Dial(socket string, timeout time.Duration) (*Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, "unix://"+socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithBlock(),
+		grpc.FailOnNonTempDialError(true))
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:       conn,
+		runtime:    runtimeapi.NewRuntimeServiceClient(conn),
+		timeout:    timeout,
+		containers: make(map[string]Container),
+		sandboxes:  make(map[string]*runtimeapi.PodSandboxStatus),
+	}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// IsTimeout reports whether err is a call running out of time: the runtime
+// is slow rather than gone.
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded
+}
+
+// Version returns the name and version of the runtime, e.g. "containerd"
+// and "v1.6.12".
+func (c *Client) Version() (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	resp, err := c.runtime.Version(ctx, &runtimeapi.VersionRequest{})
+	if err != nil {
+		return "", "", err
+	}
+	return resp.RuntimeName, resp.RuntimeVersion, nil
+}
+
+// sandbox asks for the pod of a sandbox.
+func (c *Client) sandbox(ctx context.Context, sandboxId string) (*runtimeapi.PodSandboxStatus, error) {
+	resp, err := c.runtime.PodSandboxStatus(ctx, &runtimeapi.PodSandboxStatusRequest{PodSandboxId: sandboxId})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+// status asks for the status of a container, which has the image the
+// runtime actually resolved.
+func (c *Client) status(ctx context.Context, containerId string) (*runtimeapi.ContainerStatus, error) {
+	resp, err := c.runtime.ContainerStatus(ctx, &runtimeapi.ContainerStatusRequest{ContainerId: containerId})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Status, nil
+}
+
+// Containers returns the running containers and their sandboxes. Containers
+// that go away between the calls are skipped. Only the containers and
+// sandboxes not listed by the previous call are asked about, all within
+// the client's timeout.
+func (c *Client) Containers() ([]Container, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	resp, err := c.runtime.ListContainers(ctx, &runtimeapi.ListContainersRequest{
+		Filter: &runtimeapi.ContainerFilter{
+			State: &runtimeapi.ContainerStateValue{State: runtimeapi.ContainerState_CONTAINER_RUNNING},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]Container, 0, len(resp.Containers))
+	listedContainers := make(map[string]Container, len(resp.Containers))
+	listedSandboxes := make(map[string]*runtimeapi.PodSandboxStatus)
+	for _, listed := range resp.Containers {
+		sandbox, ok := listedSandboxes[listed.PodSandboxId]
+		if !ok {
+			if sandbox, ok = c.sandboxes[listed.PodSandboxId]; !ok {
+				sandbox, err = c.sandbox(ctx, listed.PodSandboxId)
+				if err != nil || sandbox == nil {
+					continue
+				}
+			}
+			listedSandboxes[listed.PodSandboxId] = sandbox
+			containers = append(containers, newSandboxContainer(sandbox))
+		}
+
+		container, ok := c.containers[listed.Id]
+		if !ok {
+			status, err := c.status(ctx, listed.Id)
+			if err != nil || status == nil {
+				continue
+			}
+			container = newContainer(sandbox, status)
+		}
+		listedContainers[listed.Id] = container
+		containers = append(containers, container)
+	}
+	if ctx.Err() != nil {
+		// The next call goes on from what was asked before the deadline.
+		for id, container := range listedContainers {
+			c.containers[id] = container
+		}
+		for id, sandbox := range listedSandboxes {
+			c.sandboxes[id] = sandbox
+		}
+		return nil, ctx.Err()
+	}
+
+	c.containers = listedContainers
+	c.sandboxes = listedSandboxes
+	return containers, nil
+}
+
+// newContainer builds a container from its status and its sandbox's.
+func newContainer(sandbox *runtimeapi.PodSandboxStatus, status *runtimeapi.ContainerStatus) Container {
+	container := newSandboxContainer(sandbox)
+	container.Id = status.Id
+	container.Sandbox = false
+	container.Labels = status.Labels
+	container.Annotations = status.Annotations
+	container.ImageRef = status.ImageRef
+	if status.Image != nil {
+		container.Image = status.Image.Image
+	}
+	if status.Metadata != nil {
+		container.Name = status.Metadata.Name
+		container.RestartCount = (int)(status.Metadata.Attempt)
+	}
+	if restartCount, err := strconv.Atoi(status.Annotations[restartCountAnnotation]); err == nil {
+		container.RestartCount = restartCount
+	}
+	return container
+}
+
+func newSandboxContainer(sandbox *runtimeapi.PodSandboxStatus) Container {
+	container := Container{
+		Id:          sandbox.Id,
+		SandboxId:   sandbox.Id,
+		Sandbox:     true,
+		Labels:      sandbox.Labels,
+		Annotations: sandbox.Annotations,
+	}
+	if sandbox.Metadata != nil {
+		container.PodName = sandbox.Metadata.Name
+		container.PodNamespace = sandbox.Metadata.Namespace
+		container.PodUid = sandbox.Metadata.Uid
+	}
+	return container
+}
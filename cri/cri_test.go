@@ -0,0 +1,97 @@
+package cri
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"container-agent/fakehost"
+)
+
+func TestClient(t *testing.T) {
+	h := fakehost.New(t)
+	srv := &fakehost.CriServer{
+		RuntimeName:    "containerd",
+		RuntimeVersion: "v1.6.12",
+		Containers: []fakehost.CriContainer{
+			{Id: "c1", SandboxId: "s1", Name: "nginx", PodName: "web-0", PodNamespace: "shop", PodUid: "uid-1",
+				Image: "docker.io/library/nginx:1.23", ImageRef: "docker.io/library/nginx@sha256:abc", RestartCount: 2,
+				Labels: map[string]string{"io.kubernetes.container.name": "nginx"}},
+			{Id: "c2", SandboxId: "s1", Name: "sidecar", PodName: "web-0", PodNamespace: "shop", PodUid: "uid-1"},
+		},
+	}
+	h.ServeCri("run/cri.sock", srv)
+
+	client, err := Dial(h.Path("run/cri.sock"), DefaultTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	name, version, err := client.Version()
+	if err != nil || name != "containerd" || version != "v1.6.12" {
+		t.Errorf("got version %q %q, %v", name, version, err)
+	}
+
+	containers, err := client.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 3 {
+		t.Fatalf("got %d containers, want the sandbox and 2 containers: %+v", len(containers), containers)
+	}
+	sandbox := Container{Id: "s1", SandboxId: "s1", Sandbox: true, PodName: "web-0", PodNamespace: "shop", PodUid: "uid-1"}
+	if !reflect.DeepEqual(containers[0], sandbox) {
+		t.Errorf("got sandbox %+v", containers[0])
+	}
+	nginx := containers[1]
+	if nginx.Id != "c1" || nginx.Name != "nginx" || nginx.PodName != "web-0" || nginx.PodUid != "uid-1" ||
+		nginx.ImageRef != "docker.io/library/nginx@sha256:abc" || nginx.RestartCount != 2 || nginx.Labels["io.kubernetes.container.name"] != "nginx" {
+		t.Errorf("got container %+v", nginx)
+	}
+
+	// Only new containers are asked about.
+	srv.Containers = append(srv.Containers, fakehost.CriContainer{Id: "c3", SandboxId: "s2", Name: "db", PodName: "db-0"})
+	containers, err = client.Containers()
+	if err != nil || len(containers) != 5 || !reflect.DeepEqual(containers[1], nginx) {
+		t.Fatalf("got %+v, %v", containers, err)
+	}
+	if got := srv.Calls("ContainerStatus"); got != 3 {
+		t.Errorf("got %d status calls, want 3", got)
+	}
+	if got := srv.Calls("PodSandboxStatus"); got != 2 {
+		t.Errorf("got %d sandbox status calls, want 2", got)
+	}
+}
+
+func TestClientDeadline(t *testing.T) {
+	h := fakehost.New(t)
+	srv := &fakehost.CriServer{StatusDelay: 50 * time.Millisecond}
+	for _, id := range []string{"c1", "c2", "c3", "c4"} {
+		srv.Containers = append(srv.Containers, fakehost.CriContainer{Id: id, SandboxId: "s1"})
+	}
+	h.ServeCri("run/cri.sock", srv)
+
+	client, err := Dial(h.Path("run/cri.sock"), 160*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The 5 status calls don't fit in a single timeout: the listing fails as
+	// a whole, and the next one goes on from where it stopped.
+	if _, err := client.Containers(); !IsTimeout(err) {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	containers, err := client.Containers()
+	if err != nil || len(containers) != 5 {
+		t.Errorf("got %+v, %v", containers, err)
+	}
+}
+
+func TestDialUnavailable(t *testing.T) {
+	h := fakehost.New(t)
+	if _, err := Dial(h.Path("run/missing.sock"), 100*time.Millisecond); err == nil {
+		t.Error("dialing a missing socket succeeded")
+	}
+}
@@ -0,0 +1,214 @@
+// Package docker is a client of the Docker Engine API served by dockerd on
+// its unix socket. It only reads: the agent inspects containers and images
+// and follows container events instead of parsing dockerd's state files,
+// whose layout changes between releases.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DefaultTimeout bounds every single request.
+const DefaultTimeout = 5 * time.Second
+
+// Error is a request the daemon answered with an error status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("docker: %d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is the daemon not knowing a container or
+// image, e.g. because it was removed since it was listed.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// ContainerSummary is a running container as listed by the daemon.
+type ContainerSummary struct {
+	Id      string            `json:"Id"`
+	Names   []string          `json:"Names"`
+	Image   string            `json:"Image"`
+	ImageId string            `json:"ImageID"`
+	Labels  map[string]string `json:"Labels"`
+	State   string            `json:"State"`
+}
+
+// Container is the part of a container inspect the agent uses. Image is
+// the ID of the image, Config.Image the reference it was created from.
+// GraphDriver.Data holds the "UpperDir" and "MergedDir" of overlay2 as
+// host paths.
+type Container struct {
+	Id           string `json:"Id"`
+	Name         string `json:"Name"`
+	Image        string `json:"Image"`
+	RestartCount int    `json:"RestartCount"`
+	Config       struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status    string `json:"Status"`
+		Running   bool   `json:"Running"`
+		Pid       int    `json:"Pid"`
+		StartedAt string `json:"StartedAt"`
+	} `json:"State"`
+	GraphDriver struct {
+		Name string            `json:"Name"`
+		Data map[string]string `json:"Data"`
+	} `json:"GraphDriver"`
+}
+
+// Image is the part of an image inspect the agent uses.
+type Image struct {
+	Id          string   `json:"Id"`
+	RepoTags    []string `json:"RepoTags"`
+	RepoDigests []string `json:"RepoDigests"`
+	Config      struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// Event is a container event, e.g. "start", "die" or "destroy". Actor.Id
+// is the container ID.
+type Event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		Id         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// Client talks to a single daemon. Requests go to the unversioned API, which
+// the daemon answers with its own version.
+type Client struct {
+	http http.Client
+}
+
+// New returns a client of the daemon listening on socket. Nothing is
+// connected until the first request.
+func New(socket string, timeout time.Duration) *Client {
+	return &Client{http: http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}}
+}
+
+// Close closes the idle connections to the daemon.
+func (c *Client) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// get requests path and returns the body of a successful response.
+func (c *Client) get(path string, query url.Values) (io.ReadCloser, error) {
+	u := url.URL{Scheme: "http", Host: "docker", Path: path, RawQuery: query.Encode()}
+	resp, err := c.http.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var message struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&message)
+		return nil, &Error{StatusCode: resp.StatusCode, Message: message.Message}
+	}
+	return resp.Body, nil
+}
+
+// getJson requests path and decodes the response into v.
+func (c *Client) getJson(path string, query url.Values, v interface{}) error {
+	body, err := c.get(path, query)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(v)
+}
+
+// Version returns the version of the daemon, e.g. "20.10.21".
+func (c *Client) Version() (string, error) {
+	var version struct {
+		Version string `json:"Version"`
+	}
+	if err := c.getJson("/version", nil, &version); err != nil {
+		return "", err
+	}
+	return version.Version, nil
+}
+
+// Containers lists the running containers.
+func (c *Client) Containers() ([]ContainerSummary, error) {
+	containers := make([]ContainerSummary, 0)
+	if err := c.getJson("/containers/json", nil, &containers); err != nil {
+		return nil, err
+	}
+	return containers, nil
+}
+
+// Inspect inspects a container by ID or name.
+func (c *Client) Inspect(containerId string) (Container, error) {
+	var container Container
+	err := c.getJson("/containers/"+url.PathEscape(containerId)+"/json", nil, &container)
+	return container, err
+}
+
+// InspectImage inspects an image by ID or reference.
+func (c *Client) InspectImage(image string) (Image, error) {
+	var img Image
+	err := c.getJson("/images/"+url.PathEscape(image)+"/json", nil, &img)
+	return img, err
+}
+
+// formatTimestamp formats t as the seconds.nanoseconds the API takes.
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10) + "." + fmt.Sprintf("%09d", t.Nanosecond())
+}
+
+// Events returns the container events from since until until, which must
+// not be in the future: the daemon streams until then.
+func (c *Client) Events(since time.Time, until time.Time) ([]Event, error) {
+	query := url.Values{}
+	query.Set("since", formatTimestamp(since))
+	query.Set("until", formatTimestamp(until))
+	query.Set("filters", `{"type":["container"]}`)
+
+	body, err := c.get("/events", query)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	events := make([]Event, 0)
+	decoder := json.NewDecoder(body)
+	for {
+		var event Event
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
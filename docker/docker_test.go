@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"testing"
+	"time"
+
+	"container-agent/fakehost"
+)
+
+func TestClient(t *testing.T) {
+	h := fakehost.New(t)
+	now := time.Now()
+	h.ServeDocker("run/docker.sock", &fakehost.DockerServer{
+		Version: "20.10.21",
+		Containers: []fakehost.DockerContainer{{
+			Id: "c1", Name: "shop_web_1", Image: "nginx:1.23", ImageId: "sha256:i1", Pid: 42, RestartCount: 1,
+			Labels:   map[string]string{"com.docker.compose.project": "shop"},
+			UpperDir: "/var/lib/docker/overlay2/l1/diff", MergedDir: "/var/lib/docker/overlay2/l1/merged",
+		}},
+		Images: []fakehost.DockerImage{{Id: "sha256:i1", RepoTags: []string{"nginx:1.23"}, RepoDigests: []string{"nginx@sha256:abc"}}},
+		Events: []fakehost.DockerEvent{
+			{ContainerId: "c0", Action: "destroy", Time: now.Add(-2 * time.Hour)},
+			{ContainerId: "c1", Action: "start", Time: now.Add(-time.Minute)},
+		},
+	})
+
+	client := New(h.Path("run/docker.sock"), DefaultTimeout)
+	defer client.Close()
+
+	version, err := client.Version()
+	if err != nil || version != "20.10.21" {
+		t.Errorf("got version %q, %v", version, err)
+	}
+
+	containers, err := client.Containers()
+	if err != nil || len(containers) != 1 || containers[0].Id != "c1" || containers[0].ImageId != "sha256:i1" {
+		t.Errorf("got containers %+v, %v", containers, err)
+	}
+
+	container, err := client.Inspect("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.Name != "/shop_web_1" || container.Image != "sha256:i1" || container.Config.Image != "nginx:1.23" ||
+		container.State.Pid != 42 || container.RestartCount != 1 || container.Config.Labels["com.docker.compose.project"] != "shop" ||
+		container.GraphDriver.Data["UpperDir"] != "/var/lib/docker/overlay2/l1/diff" {
+		t.Errorf("got %+v", container)
+	}
+
+	if _, err := client.Inspect("gone"); !IsNotFound(err) {
+		t.Errorf("got %v, want not found", err)
+	}
+
+	image, err := client.InspectImage("sha256:i1")
+	if err != nil || len(image.RepoDigests) != 1 || image.RepoDigests[0] != "nginx@sha256:abc" {
+		t.Errorf("got image %+v, %v", image, err)
+	}
+
+	events, err := client.Events(now.Add(-time.Hour), now)
+	if err != nil || len(events) != 1 || events[0].Actor.Id != "c1" || events[0].Action != "start" {
+		t.Errorf("got events %+v, %v", events, err)
+	}
+}
+
+func TestClientUnavailable(t *testing.T) {
+	h := fakehost.New(t)
+	client := New(h.Path("run/docker.sock"), DefaultTimeout)
+	if _, err := client.Version(); err == nil || IsNotFound(err) {
+		t.Errorf("got %v, want a connection error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package fakehost
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Cgroup is the cgroup of a container, Path as /proc/[pid]/cgroup shows it.
+// A MemoryLimit, CpuQuota or PidsLimit of -1 is unlimited. ThrottledUsec is
+// in microseconds whatever the version.
+type Cgroup struct {
+	Path          string
+	MemoryLimit   int64
+	MemoryUsage   int64
+	OomKills      int64
+	CpuQuota      int64
+	CpuPeriod     int64
+	NrPeriods     int64
+	NrThrottled   int64
+	ThrottledUsec int64
+	PidsLimit     int64
+	PidsCurrent   int64
+}
+
+// cgroupLimit renders limit the way the kernel does, "max" if unlimited.
+func cgroupLimit(limit int64) string {
+	if limit < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(limit, 10)
+}
+
+// AddCgroupV2 writes c to the unified hierarchy, which makes the host a
+// cgroup v2 one, and returns the /proc/[pid]/cgroup content of its
+// processes.
+func (h *Host) AddCgroupV2(c Cgroup) string {
+	h.t.Helper()
+	h.WriteFile("sys/fs/cgroup/cgroup.controllers", "cpu memory pids\n")
+	dir := "sys/fs/cgroup" + c.Path + "/"
+	h.WriteFile(dir+"memory.max", cgroupLimit(c.MemoryLimit)+"\n")
+	h.WriteFile(dir+"memory.current", fmt.Sprintf("%d\n", c.MemoryUsage))
+	h.WriteFile(dir+"memory.events", fmt.Sprintf("low 0\nhigh 0\nmax 0\noom %d\noom_kill %d\n", c.OomKills, c.OomKills))
+	h.WriteFile(dir+"cpu.max", fmt.Sprintf("%s %d\n", cgroupLimit(c.CpuQuota), c.CpuPeriod))
+	h.WriteFile(dir+"cpu.stat", fmt.Sprintf("usage_usec 0\nuser_usec 0\nsystem_usec 0\nnr_periods %d\nnr_throttled %d\nthrottled_usec %d\n",
+		c.NrPeriods, c.NrThrottled, c.ThrottledUsec))
+	h.WriteFile(dir+"pids.max", cgroupLimit(c.PidsLimit)+"\n")
+	h.WriteFile(dir+"pids.current", fmt.Sprintf("%d\n", c.PidsCurrent))
+	return "0::" + c.Path
+}
+
+// AddCgroupV1 writes c to the memory, cpu,cpuacct and pids hierarchies,
+// with cpu and cpuacct linked to the shared one as systemd does, and
+// returns the /proc/[pid]/cgroup content of its processes.
+func (h *Host) AddCgroupV1(c Cgroup) string {
+	h.t.Helper()
+	memoryLimit := c.MemoryLimit
+	if memoryLimit < 0 {
+		// PAGE_COUNTER_MAX in bytes, rounded down to 4k pages.
+		memoryLimit = 0x7FFFFFFFFFFFF000
+	}
+	dir := "sys/fs/cgroup/memory" + c.Path + "/"
+	h.WriteFile(dir+"memory.limit_in_bytes", fmt.Sprintf("%d\n", memoryLimit))
+	h.WriteFile(dir+"memory.usage_in_bytes", fmt.Sprintf("%d\n", c.MemoryUsage))
+	h.WriteFile(dir+"memory.oom_control", fmt.Sprintf("oom_kill_disable 0\nunder_oom 0\noom_kill %d\n", c.OomKills))
+
+	for _, link := range []string{"cpu", "cpuacct"} {
+		if _, err := os.Lstat(h.Path("sys/fs/cgroup/" + link)); os.IsNotExist(err) {
+			h.Symlink("cpu,cpuacct", "sys/fs/cgroup/"+link)
+		}
+	}
+	dir = "sys/fs/cgroup/cpu,cpuacct" + c.Path + "/"
+	h.WriteFile(dir+"cpu.cfs_quota_us", fmt.Sprintf("%d\n", c.CpuQuota))
+	h.WriteFile(dir+"cpu.cfs_period_us", fmt.Sprintf("%d\n", c.CpuPeriod))
+	h.WriteFile(dir+"cpu.stat", fmt.Sprintf("nr_periods %d\nnr_throttled %d\nthrottled_time %d\n",
+		c.NrPeriods, c.NrThrottled, c.ThrottledUsec*1000))
+
+	dir = "sys/fs/cgroup/pids" + c.Path + "/"
+	h.WriteFile(dir+"pids.max", cgroupLimit(c.PidsLimit)+"\n")
+	h.WriteFile(dir+"pids.current", fmt.Sprintf("%d\n", c.PidsCurrent))
+
+	return "12:pids:" + c.Path + "\n4:cpu,cpuacct:" + c.Path + "\n11:memory:" + c.Path + "\n1:name=systemd:" + c.Path
+}
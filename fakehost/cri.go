@@ -0,0 +1,141 @@
+package fakehost
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// CriContainer is a running container of a CriServer, in the pod of its
+// sandbox.
+type CriContainer struct {
+	Id           string
+	SandboxId    string
+	Name         string
+	PodName      string
+	PodNamespace string
+	PodUid       string
+	Image        string
+	ImageRef     string
+	Labels       map[string]string
+	Annotations  map[string]string
+	RestartCount int
+}
+
+// CriServer is an in-process CRI runtime service answering the calls the
+// agent makes from a fixed list of containers. Anything else is
+// unimplemented. StatusDelay slows down every status call, Calls counts
+// the calls per method, e.g. "ContainerStatus".
+type CriServer struct {
+	runtimeapi.UnimplementedRuntimeServiceServer
+	RuntimeName    string
+	RuntimeVersion string
+	Containers     []CriContainer
+	StatusDelay    time.Duration
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// Calls returns how often method was called.
+func (s *CriServer) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *CriServer) called(ctx context.Context, method string, delay time.Duration) {
+	s.mu.Lock()
+	if s.calls == nil {
+		s.calls = make(map[string]int)
+	}
+	s.calls[method]++
+	s.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+	}
+}
+
+// ServeCri serves srv on a unix socket at relPath until the test ends.
+func (h *Host) ServeCri(relPath string, srv *CriServer) {
+	h.t.Helper()
+	listener := h.Listen(relPath)
+	server := grpc.NewServer()
+	runtimeapi.RegisterRuntimeServiceServer(server, srv)
+	go server.Serve(listener)
+	h.t.Cleanup(server.Stop)
+}
+
+func (s *CriServer) Version(ctx context.Context, req *runtimeapi.VersionRequest) (*runtimeapi.VersionResponse, error) {
+	s.called(ctx, "Version", 0)
+	return &runtimeapi.VersionResponse{
+		Version:           "0.1.0",
+		RuntimeName:       s.RuntimeName,
+		RuntimeVersion:    s.RuntimeVersion,
+		RuntimeApiVersion: "v1",
+	}, nil
+}
+
+func (s *CriServer) ListContainers(ctx context.Context, req *runtimeapi.ListContainersRequest) (*runtimeapi.ListContainersResponse, error) {
+	s.called(ctx, "ListContainers", 0)
+	resp := &runtimeapi.ListContainersResponse{}
+	for _, c := range s.Containers {
+		resp.Containers = append(resp.Containers, &runtimeapi.Container{
+			Id:           c.Id,
+			PodSandboxId: c.SandboxId,
+			Metadata:     &runtimeapi.ContainerMetadata{Name: c.Name, Attempt: (uint32)(c.RestartCount)},
+			Image:        &runtimeapi.ImageSpec{Image: c.Image},
+			ImageRef:     c.ImageRef,
+			State:        runtimeapi.ContainerState_CONTAINER_RUNNING,
+			Labels:       c.Labels,
+			Annotations:  c.Annotations,
+		})
+	}
+	return resp, nil
+}
+
+func (s *CriServer) ContainerStatus(ctx context.Context, req *runtimeapi.ContainerStatusRequest) (*runtimeapi.ContainerStatusResponse, error) {
+	s.called(ctx, "ContainerStatus", s.StatusDelay)
+	for _, c := range s.Containers {
+		if c.Id != req.ContainerId {
+			continue
+		}
+		annotations := map[string]string{"io.kubernetes.container.restartCount": strconv.Itoa(c.RestartCount)}
+		for key, value := range c.Annotations {
+			annotations[key] = value
+		}
+		return &runtimeapi.ContainerStatusResponse{Status: &runtimeapi.ContainerStatus{
+			Id:          c.Id,
+			Metadata:    &runtimeapi.ContainerMetadata{Name: c.Name, Attempt: (uint32)(c.RestartCount)},
+			State:       runtimeapi.ContainerState_CONTAINER_RUNNING,
+			Image:       &runtimeapi.ImageSpec{Image: c.Image},
+			ImageRef:    c.ImageRef,
+			Labels:      c.Labels,
+			Annotations: annotations,
+		}}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "container %q not found", req.ContainerId)
+}
+
+func (s *CriServer) PodSandboxStatus(ctx context.Context, req *runtimeapi.PodSandboxStatusRequest) (*runtimeapi.PodSandboxStatusResponse, error) {
+	s.called(ctx, "PodSandboxStatus", s.StatusDelay)
+	for _, c := range s.Containers {
+		if c.SandboxId != req.PodSandboxId {
+			continue
+		}
+		return &runtimeapi.PodSandboxStatusResponse{Status: &runtimeapi.PodSandboxStatus{
+			Id:       c.SandboxId,
+			Metadata: &runtimeapi.PodSandboxMetadata{Name: c.PodName, Uid: c.PodUid, Namespace: c.PodNamespace},
+			State:    runtimeapi.PodSandboxState_SANDBOX_READY,
+		}}, nil
+	}
+	return nil, status.Errorf(codes.NotFound, "pod sandbox %q not found", req.PodSandboxId)
+}
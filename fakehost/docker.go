@@ -0,0 +1,166 @@
+package fakehost
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DockerContainer is a running container of a DockerServer. UpperDir and
+// MergedDir are host paths, as the daemon reports them.
+type DockerContainer struct {
+	Id           string
+	Name         string
+	Image        string
+	ImageId      string
+	Labels       map[string]string
+	Pid          int
+	RestartCount int
+	UpperDir     string
+	MergedDir    string
+}
+
+// DockerImage is an image of a DockerServer.
+type DockerImage struct {
+	Id          string
+	RepoTags    []string
+	RepoDigests []string
+	Labels      map[string]string
+}
+
+// DockerEvent is a container event of a DockerServer.
+type DockerEvent struct {
+	ContainerId string
+	Action      string
+	Time        time.Time
+}
+
+// DockerServer is an in-process Docker Engine API answering the requests
+// the agent makes from fixed lists. Anything else is not found. Requests
+// counts the requests per path, e.g. "/containers/<id>/json".
+type DockerServer struct {
+	Version    string
+	Containers []DockerContainer
+	Images     []DockerImage
+	Events     []DockerEvent
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+// ServeDocker serves srv on a unix socket at relPath until the test ends.
+func (h *Host) ServeDocker(relPath string, srv *DockerServer) {
+	h.t.Helper()
+	listener := h.Listen(relPath)
+	server := &http.Server{Handler: srv}
+	go server.Serve(listener)
+	h.t.Cleanup(func() { server.Close() })
+}
+
+// AddEvent adds an event while srv is serving.
+func (s *DockerServer) AddEvent(event DockerEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Events = append(s.Events, event)
+}
+
+// Requests returns how often path was requested.
+func (s *DockerServer) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func writeDockerJson(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeDockerNotFound(w http.ResponseWriter, what string) {
+	writeDockerJson(w, http.StatusNotFound, map[string]string{"message": "No such " + what})
+}
+
+// parseDockerTimestamp parses the seconds.nanoseconds the API takes.
+func parseDockerTimestamp(value string) time.Time {
+	seconds, nanos, _ := strings.Cut(value, ".")
+	sec, _ := strconv.ParseInt(seconds, 10, 64)
+	nsec, _ := strconv.ParseInt(nanos, 10, 64)
+	return time.Unix(sec, nsec)
+}
+
+func (s *DockerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.requests == nil {
+		s.requests = make(map[string]int)
+	}
+	s.requests[r.URL.Path]++
+	events := s.Events
+	s.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/version":
+		writeDockerJson(w, http.StatusOK, map[string]string{"Version": s.Version, "ApiVersion": "1.41"})
+	case r.URL.Path == "/containers/json":
+		containers := make([]map[string]interface{}, 0, len(s.Containers))
+		for _, c := range s.Containers {
+			containers = append(containers, map[string]interface{}{
+				"Id": c.Id, "Names": []string{"/" + c.Name}, "Image": c.Image, "ImageID": c.ImageId,
+				"Labels": c.Labels, "State": "running",
+			})
+		}
+		writeDockerJson(w, http.StatusOK, containers)
+	case strings.HasPrefix(r.URL.Path, "/containers/") && strings.HasSuffix(r.URL.Path, "/json"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/containers/"), "/json")
+		for _, c := range s.Containers {
+			if c.Id != id {
+				continue
+			}
+			writeDockerJson(w, http.StatusOK, map[string]interface{}{
+				"Id": c.Id, "Name": "/" + c.Name, "Image": c.ImageId, "RestartCount": c.RestartCount,
+				"Config": map[string]interface{}{"Image": c.Image, "Labels": c.Labels},
+				"State":  map[string]interface{}{"Status": "running", "Running": true, "Pid": c.Pid},
+				"GraphDriver": map[string]interface{}{
+					"Name": "overlay2",
+					"Data": map[string]string{"UpperDir": c.UpperDir, "MergedDir": c.MergedDir},
+				},
+			})
+			return
+		}
+		writeDockerNotFound(w, "container: "+id)
+	case strings.HasPrefix(r.URL.Path, "/images/") && strings.HasSuffix(r.URL.Path, "/json"):
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/json")
+		for _, image := range s.Images {
+			if image.Id != id {
+				continue
+			}
+			writeDockerJson(w, http.StatusOK, map[string]interface{}{
+				"Id": image.Id, "RepoTags": image.RepoTags, "RepoDigests": image.RepoDigests,
+				"Config": map[string]interface{}{"Labels": image.Labels},
+			})
+			return
+		}
+		writeDockerNotFound(w, "image: "+id)
+	case r.URL.Path == "/events":
+		since := parseDockerTimestamp(r.URL.Query().Get("since"))
+		until := parseDockerTimestamp(r.URL.Query().Get("until"))
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		for _, event := range events {
+			if event.Time.Before(since) || event.Time.After(until) {
+				continue
+			}
+			encoder.Encode(map[string]interface{}{
+				"Type": "container", "Action": event.Action,
+				"Actor":    map[string]interface{}{"ID": event.ContainerId},
+				"time":     event.Time.Unix(),
+				"timeNano": event.Time.UnixNano(),
+			})
+		}
+	default:
+		writeDockerNotFound(w, "endpoint: "+r.URL.Path)
+	}
+}
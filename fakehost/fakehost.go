@@ -0,0 +1,244 @@
+// Package fakehost builds synthetic host filesystems for tests: a /proc
+// tree and the docker, containerd and cri-o state directories, laid out the
+// way the agent's daemonset mounts the real ones below its host root.
+package fakehost
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Host is a synthetic host root. Paths given to its methods are relative
+// to Root.
+type Host struct {
+	t    testing.TB
+	Root string
+}
+
+// New creates an empty host root in a temporary directory that is removed
+// when the test ends.
+func New(t testing.TB) *Host {
+	t.Helper()
+	h := &Host{t: t, Root: t.TempDir()}
+	h.WriteFile("proc/uptime", "1000.00 4000.00\n")
+	h.WriteFile("proc/stat", "cpu  100 0 100 1000 0 0 0 0 0 0\ncpu0 50 0 50 500 0 0 0 0 0 0\ncpu1 50 0 50 500 0 0 0 0 0 0\nbtime 1600000000\n")
+	return h
+}
+
+// Path returns the absolute path of relPath below the host root.
+func (h *Host) Path(relPath string) string {
+	return filepath.Join(h.Root, relPath)
+}
+
+// WriteFile writes content to relPath, creating its parent directories.
+func (h *Host) WriteFile(relPath string, content string) {
+	h.t.Helper()
+	filePath := h.Path(relPath)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// AppendFile appends content to relPath, creating it if needed.
+func (h *Host) AppendFile(relPath string, content string) {
+	h.t.Helper()
+	old, err := os.ReadFile(h.Path(relPath))
+	if err != nil && !os.IsNotExist(err) {
+		h.t.Fatal(err)
+	}
+	h.WriteFile(relPath, string(old)+content)
+}
+
+// Symlink creates relPath pointing at target, which is used verbatim.
+func (h *Host) Symlink(target string, relPath string) {
+	h.t.Helper()
+	linkPath := h.Path(relPath)
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		h.t.Fatal(err)
+	}
+	if err := os.Symlink(target, linkPath); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// Listen creates a unix socket at relPath, closed when the test ends.
+// Paths of unix sockets are limited to 108 bytes, so keep relPath short.
+func (h *Host) Listen(relPath string) net.Listener {
+	h.t.Helper()
+	socketPath := h.Path(relPath)
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		h.t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+// WriteJson marshals v into relPath.
+func (h *Host) WriteJson(relPath string, v interface{}) {
+	h.t.Helper()
+	content, err := json.Marshal(v)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.WriteFile(relPath, string(content))
+}
+
+// Process is a process to put in the fake /proc. Zero values get sensible
+// defaults: state "S", comm from the first cmdline argument. Namespaces maps
+// namespace types to the inodes the ns links point at, Fds are the targets
+// of the fd links (e.g. "socket:[1234]") and Net maps the files of
+// /proc/[pid]/net to their content. Cwd and Exe are the targets of the cwd
+// and exe links.
+type Process struct {
+	Pid        int
+	PPid       int
+	Comm       string
+	State      string
+	Cmdline    []string
+	Cgroup     string
+	Uid        int
+	UTime      uint64
+	STime      uint64
+	StartTime  uint64
+	VSize      uint64
+	RssKb      uint64
+	Namespaces map[string]uint64
+	Fds        []string
+	Net        map[string]string
+	Cwd        string
+	Exe        string
+	Environ    []string
+}
+
+// AddProcess writes stat, status, cmdline and cgroup of p below proc/.
+func (h *Host) AddProcess(p Process) {
+	h.t.Helper()
+	if p.State == "" {
+		p.State = "S"
+	}
+	if p.Comm == "" && len(p.Cmdline) > 0 {
+		p.Comm = filepath.Base(p.Cmdline[0])
+	}
+	if len(p.Comm) > 15 {
+		p.Comm = p.Comm[:15]
+	}
+	if p.Cgroup == "" {
+		p.Cgroup = "0::/"
+	}
+
+	dir := fmt.Sprintf("proc/%d/", p.Pid)
+
+	h.WriteFile(dir+"stat", fmt.Sprintf("%d (%s) %s %d %d %d 0 -1 4194560 100 0 0 0 %d %d 0 0 20 0 1 0 %d %d %d 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+		p.Pid, p.Comm, p.State, p.PPid, p.Pid, p.Pid, p.UTime, p.STime, p.StartTime, p.VSize, p.RssKb/4))
+
+	h.WriteFile(dir+"status", fmt.Sprintf("Name:\t%s\nState:\t%s\nTgid:\t%d\nPid:\t%d\nPPid:\t%d\nUid:\t%d\t%d\t%d\t%d\nGid:\t%d\t%d\t%d\t%d\nVmSize:\t%d kB\nVmRSS:\t%d kB\nRssAnon:\t%d kB\nRssFile:\t0 kB\nRssShmem:\t0 kB\nVmSwap:\t0 kB\nThreads:\t1\n",
+		p.Comm, p.State, p.Pid, p.Pid, p.PPid, p.Uid, p.Uid, p.Uid, p.Uid, p.Uid, p.Uid, p.Uid, p.Uid, p.VSize/1024, p.RssKb, p.RssKb))
+
+	var cmdline string
+	if len(p.Cmdline) > 0 {
+		cmdline = strings.Join(p.Cmdline, "\x00") + "\x00"
+	}
+	h.WriteFile(dir+"cmdline", cmdline)
+	h.WriteFile(dir+"cgroup", strings.TrimSuffix(p.Cgroup, "\n")+"\n")
+	for nsType, inode := range p.Namespaces {
+		h.Symlink(fmt.Sprintf("%s:[%d]", nsType, inode), dir+"ns/"+nsType)
+	}
+	for fd, target := range p.Fds {
+		h.Symlink(target, fmt.Sprintf("%sfd/%d", dir, fd))
+	}
+	for file, content := range p.Net {
+		h.WriteFile(dir+"net/"+file, content)
+	}
+	if p.Cwd != "" {
+		h.Symlink(p.Cwd, dir+"cwd")
+	}
+	if p.Exe != "" {
+		h.Symlink(p.Exe, dir+"exe")
+	}
+	if len(p.Environ) > 0 {
+		h.WriteFile(dir+"environ", strings.Join(p.Environ, "\x00")+"\x00")
+	}
+}
+
+// AddFiles creates files (or, with a trailing "/", directories) below dir.
+func (h *Host) AddFiles(dir string, files []string) {
+	h.t.Helper()
+	for _, file := range files {
+		if strings.HasSuffix(file, "/") {
+			if err := os.MkdirAll(h.Path(filepath.Join(dir, file)), 0755); err != nil {
+				h.t.Fatal(err)
+			}
+			continue
+		}
+		h.WriteFile(filepath.Join(dir, file), file)
+	}
+}
+
+// AddDockerContainer writes the docker and moby (runc) state of a
+// container whose overlay2 upper dir holds files.
+func (h *Host) AddDockerContainer(id string, podName string, files []string) {
+	h.t.Helper()
+	h.WriteJson("docker/containers/"+id+"/config.v2.json", map[string]interface{}{
+		"ID": id,
+		"Config": map[string]interface{}{
+			"Labels": map[string]string{"io.kubernetes.pod.name": podName},
+		},
+	})
+	h.WriteJson("moby/"+id+"/state.json", map[string]interface{}{
+		"id":     id,
+		"config": map[string]interface{}{"rootfs": "/var/lib/docker/overlay2/" + id + "/merged"},
+	})
+	h.AddFiles("docker/overlay2/"+id+"/diff", files)
+}
+
+// ContainerdContainer is a container of the containerd k8s.io namespace.
+// Type is "container" or "sandbox", Snapshot the overlayfs snapshot ID
+// holding its upper dir.
+type ContainerdContainer struct {
+	Id          string
+	SandboxId   string
+	SandboxName string
+	Type        string
+	Snapshot    int
+	Files       []string
+}
+
+// AddContainerdContainer writes the task bundle of c, mounts its rootfs in
+// PID 1's mount table and fills its snapshot with c.Files.
+func (h *Host) AddContainerdContainer(c ContainerdContainer) {
+	h.t.Helper()
+	h.WriteJson("k8s.io/"+c.Id+"/config.json", map[string]interface{}{
+		"annotations": map[string]string{
+			"io.kubernetes.cri.container-type": c.Type,
+			"io.kubernetes.cri.sandbox-id":     c.SandboxId,
+			"io.kubernetes.cri.sandbox-name":   c.SandboxName,
+		},
+	})
+	snapshots := "/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs/snapshots/"
+	h.AppendFile("proc/1/mounts", fmt.Sprintf("overlay /run/containerd/io.containerd.runtime.v2.task/k8s.io/%s/rootfs overlay rw,relatime,lowerdir=%s%d/fs,upperdir=%s%d/fs,workdir=%s%d/work 0 0\n",
+		c.Id, snapshots, c.Snapshot-1, snapshots, c.Snapshot, snapshots, c.Snapshot))
+	h.AddFiles(fmt.Sprintf("snapshots/%d/fs", c.Snapshot), c.Files)
+}
+
+// AddCrioContainer writes the cri-o state of a container whose overlay
+// upper dir holds files.
+func (h *Host) AddCrioContainer(id string, podName string, files []string) {
+	h.t.Helper()
+	h.WriteJson("containers/storage/overlay-containers/"+id+"/userdata/config.json", map[string]interface{}{
+		"root":        map[string]string{"path": "/var/lib/containers/storage/overlay/" + id + "/merged"},
+		"annotations": map[string]string{"io.kubernetes.pod.name": podName},
+	})
+	h.AddFiles("containers/storage/overlay/"+id+"/diff", files)
+}
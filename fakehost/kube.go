@@ -0,0 +1,263 @@
+package fakehost
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// KubeOwner is the controller of a pod or a workload object.
+type KubeOwner struct {
+	Kind string
+	Name string
+}
+
+// KubeContainer is a container of a KubePod with its resources, as
+// quantities like "250m" or "128Mi".
+type KubeContainer struct {
+	Name     string
+	Requests map[string]string
+	Limits   map[string]string
+}
+
+type KubePod struct {
+	Name           string
+	Namespace      string
+	Uid            string
+	NodeName       string
+	ServiceAccount string
+	Labels         map[string]string
+	Owner          *KubeOwner
+	Containers     []KubeContainer
+}
+
+// KubeObject is a workload object (ReplicaSet, Deployment, Job...) owner
+// references can point to.
+type KubeObject struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Owner     *KubeOwner
+}
+
+type kubeEvent struct {
+	version   int
+	eventType string
+	pod       KubePod
+}
+
+// KubeServer is an in-process Kubernetes API server answering the pod list
+// and watch and the workload gets the agent makes, for clients presenting
+// Token. Anything else is not found. Resources, if set, are the only
+// resources (e.g. "pods", "replicasets") Token grants access to, like RBAC
+// would; the others are forbidden.
+type KubeServer struct {
+	Token     string
+	Pods      []KubePod
+	Objects   []KubeObject
+	Resources []string
+
+	mu      sync.Mutex
+	events  []kubeEvent
+	changed chan struct{}
+}
+
+// ServeKube serves srv over TLS until the test ends, writes the token and
+// CA of a service account for it to serviceaccount/ and points the
+// in-cluster environment at it. It returns the service account dir.
+func (h *Host) ServeKube(srv *KubeServer) string {
+	h.t.Helper()
+	server := httptest.NewTLSServer(srv)
+	h.t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	h.t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	h.WriteFile("serviceaccount/token", srv.Token+"\n")
+	h.WriteFile("serviceaccount/ca.crt", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+	return h.Path("serviceaccount")
+}
+
+// Update changes a pod, DELETED removing it, and tells the watches.
+func (s *KubeServer) Update(eventType string, pod KubePod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pods := make([]KubePod, 0, len(s.Pods))
+	for _, p := range s.Pods {
+		if p.Uid != pod.Uid {
+			pods = append(pods, p)
+		}
+	}
+	if eventType != "DELETED" {
+		pods = append(pods, pod)
+	}
+	s.Pods = pods
+
+	s.events = append(s.events, kubeEvent{version: len(s.events) + 1, eventType: eventType, pod: pod})
+	if s.changed != nil {
+		close(s.changed)
+		s.changed = nil
+	}
+}
+
+func kubeOwnerReferences(owner *KubeOwner) []map[string]interface{} {
+	if owner == nil {
+		return nil
+	}
+	return []map[string]interface{}{{
+		"apiVersion": "v1", "kind": owner.Kind, "name": owner.Name, "uid": "uid-" + owner.Name, "controller": true,
+	}}
+}
+
+func kubePodJson(pod KubePod, version int) map[string]interface{} {
+	containers := make([]map[string]interface{}, 0, len(pod.Containers))
+	for _, c := range pod.Containers {
+		containers = append(containers, map[string]interface{}{
+			"name":      c.Name,
+			"resources": map[string]interface{}{"requests": c.Requests, "limits": c.Limits},
+		})
+	}
+	return map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": pod.Name, "namespace": pod.Namespace, "uid": pod.Uid, "labels": pod.Labels,
+			"resourceVersion": strconv.Itoa(version), "ownerReferences": kubeOwnerReferences(pod.Owner),
+		},
+		"spec": map[string]interface{}{
+			"nodeName": pod.NodeName, "serviceAccountName": pod.ServiceAccount, "containers": containers,
+		},
+	}
+}
+
+func writeKubeStatus(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "code": code, "message": message})
+}
+
+// ownerKinds are the kinds of KubeObjects by the resource in their path.
+var ownerKinds = map[string]string{
+	"replicasets": "ReplicaSet", "deployments": "Deployment", "statefulsets": "StatefulSet",
+	"daemonsets": "DaemonSet", "jobs": "Job", "cronjobs": "CronJob",
+}
+
+// allowed tells whether Token grants access to the resource of path.
+func (s *KubeServer) allowed(path string) bool {
+	if s.Resources == nil {
+		return true
+	}
+	parts := strings.Split(path, "/")
+	for _, resource := range s.Resources {
+		if (path == "/api/v1/pods" && resource == "pods") || (len(parts) == 8 && parts[6] == resource) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *KubeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeKubeStatus(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !s.allowed(r.URL.Path) {
+		writeKubeStatus(w, http.StatusForbidden, fmt.Sprintf("%s is forbidden", r.URL.Path))
+		return
+	}
+
+	if r.URL.Path == "/api/v1/pods" {
+		nodeName := strings.TrimPrefix(r.URL.Query().Get("fieldSelector"), "spec.nodeName=")
+		if r.URL.Query().Get("watch") == "true" {
+			version, _ := strconv.Atoi(r.URL.Query().Get("resourceVersion"))
+			s.watchPods(w, r, nodeName, version)
+			return
+		}
+		s.mu.Lock()
+		items := make([]map[string]interface{}, 0)
+		for _, pod := range s.Pods {
+			if pod.NodeName == nodeName {
+				items = append(items, kubePodJson(pod, len(s.events)))
+			}
+		}
+		list := map[string]interface{}{
+			"metadata": map[string]string{"resourceVersion": strconv.Itoa(len(s.events))},
+			"items":    items,
+		}
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+		return
+	}
+
+	// /apis/<group>/<version>/namespaces/<namespace>/<resource>/<name>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) == 7 && parts[0] == "apis" && parts[3] == "namespaces" {
+		for _, object := range s.Objects {
+			if object.Kind == ownerKinds[parts[5]] && object.Namespace == parts[4] && object.Name == parts[6] {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"kind": object.Kind,
+					"metadata": map[string]interface{}{
+						"name": object.Name, "namespace": object.Namespace, "uid": "uid-" + object.Name,
+						"ownerReferences": kubeOwnerReferences(object.Owner),
+					},
+				})
+				return
+			}
+		}
+	}
+	writeKubeStatus(w, http.StatusNotFound, fmt.Sprintf("%s not found", r.URL.Path))
+}
+
+// watchPods streams the events after version, then every update, until
+// the client goes away.
+func (s *KubeServer) watchPods(w http.ResponseWriter, r *http.Request, nodeName string, version int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	for {
+		s.mu.Lock()
+		if version > len(s.events) {
+			version = len(s.events)
+		}
+		events := s.events[version:]
+		version = len(s.events)
+		if s.changed == nil {
+			s.changed = make(chan struct{})
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		for _, event := range events {
+			if event.pod.NodeName == nodeName {
+				encoder.Encode(map[string]interface{}{"type": event.eventType, "object": kubePodJson(event.pod, event.version)})
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package job
 
 import (
+	"container-agent/module"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -52,6 +53,8 @@ type AgentInfo struct {
 	NodeIP       string `json:"NodeIP"`
 	PodIP        string `json:"PodIP"`
 	MacAdress    string `json:"MacAdress"`
+	// Node is left out until the first Monitoring() run has written it.
+	Node *module.NodeInfo `json:"Node,omitempty"`
 }
 
 func RegisterAgent() string {
@@ -63,6 +66,9 @@ func RegisterAgent() string {
 	agentinfo.PodIP = os.Getenv("CSA_POD_IP")
 	agentinfo.NodeIP = os.Getenv("CSA_NODE_IP")
 	agentinfo.MacAdress = GetMacAddress()
+	if nodeInfo, err := module.ReadNodeInfo(); err == nil {
+		agentinfo.Node = &nodeInfo
+	}
 
 	jsonMerged, err := json.MarshalIndent(agentinfo, "", "  ")
 	if err != nil {
@@ -0,0 +1,312 @@
+// Package kube is a small client of the Kubernetes API for an agent
+// running in a pod. It only reads: it lists and watches the pods of a node
+// and gets the objects their owner references point to.
+package kube
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultServiceAccountDir is where the kubelet mounts the token and CA of
+// the pod's service account.
+const DefaultServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// DefaultTimeout bounds every request but watches.
+const DefaultTimeout = 10 * time.Second
+
+// Watch event types.
+const (
+	EventAdded    = "ADDED"
+	EventModified = "MODIFIED"
+	EventDeleted  = "DELETED"
+	EventBookmark = "BOOKMARK"
+	EventError    = "ERROR"
+)
+
+// Config is where the API server is and how to authenticate to it. The
+// token is read from TokenFile on every request, as the kubelet rotates it.
+type Config struct {
+	Host      string
+	TokenFile string
+	CAData    []byte
+}
+
+// InClusterConfig returns the config of the pod's service account, as
+// mounted in serviceAccountDir, for the API server the kubelet announces
+// in the environment.
+func InClusterConfig(serviceAccountDir string) (Config, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return Config{}, errors.New("kube: KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT not set, not running in a pod")
+	}
+	caData, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return Config{}, err
+	}
+	return Config{
+		Host:      "https://" + net.JoinHostPort(host, port),
+		TokenFile: filepath.Join(serviceAccountDir, "token"),
+		CAData:    caData,
+	}, nil
+}
+
+// Error is a request the API server answered with an error status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("kube: %d %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is the API server not knowing an object.
+func IsNotFound(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.StatusCode == http.StatusNotFound
+}
+
+// OwnerReference points to the object owning another one. Controller is
+// set on the one managing it.
+type OwnerReference struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Uid        string `json:"uid"`
+	Controller bool   `json:"controller"`
+}
+
+// ObjectMeta is the part of the metadata of an object the agent uses.
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	Uid             string            `json:"uid"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels"`
+	OwnerReferences []OwnerReference  `json:"ownerReferences"`
+}
+
+// ControllerRef returns the owner reference of the object's controller.
+func (m ObjectMeta) ControllerRef() (OwnerReference, bool) {
+	for _, ref := range m.OwnerReferences {
+		if ref.Controller {
+			return ref, true
+		}
+	}
+	return OwnerReference{}, false
+}
+
+// Resources are the requests and limits of a container, as quantities like
+// "250m" or "128Mi".
+type Resources struct {
+	Requests map[string]string `json:"requests"`
+	Limits   map[string]string `json:"limits"`
+}
+
+type Container struct {
+	Name      string    `json:"name"`
+	Resources Resources `json:"resources"`
+}
+
+type PodSpec struct {
+	NodeName           string      `json:"nodeName"`
+	ServiceAccountName string      `json:"serviceAccountName"`
+	InitContainers     []Container `json:"initContainers"`
+	Containers         []Container `json:"containers"`
+}
+
+// Pod is the part of a pod the agent uses.
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     PodSpec    `json:"spec"`
+}
+
+// Container returns the container or init container named name.
+func (p Pod) Container(name string) (Container, bool) {
+	for _, containers := range [][]Container{p.Spec.Containers, p.Spec.InitContainers} {
+		for _, container := range containers {
+			if container.Name == name {
+				return container, true
+			}
+		}
+	}
+	return Container{}, false
+}
+
+// PodList is a list of pods, and the resource version to watch it from.
+type PodList struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Items []Pod `json:"items"`
+}
+
+// WatchEvent is a change of a watched pod. Bookmarks only carry the
+// resource version to resume from.
+type WatchEvent struct {
+	Type   string `json:"type"`
+	Object Pod    `json:"object"`
+}
+
+// ownerPaths are the API paths of the owners the agent follows further up,
+// by kind.
+var ownerPaths = map[string]string{
+	"ReplicaSet":  "/apis/apps/v1/namespaces/%s/replicasets/%s",
+	"Deployment":  "/apis/apps/v1/namespaces/%s/deployments/%s",
+	"StatefulSet": "/apis/apps/v1/namespaces/%s/statefulsets/%s",
+	"DaemonSet":   "/apis/apps/v1/namespaces/%s/daemonsets/%s",
+	"Job":         "/apis/batch/v1/namespaces/%s/jobs/%s",
+	"CronJob":     "/apis/batch/v1/namespaces/%s/cronjobs/%s",
+}
+
+// Client talks to a single API server.
+type Client struct {
+	config Config
+	http   http.Client
+}
+
+// New returns a client of the API server of config. Nothing is connected
+// until the first request.
+func New(config Config) (*Client, error) {
+	tlsConfig := &tls.Config{}
+	if len(config.CAData) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(config.CAData) {
+			return nil, errors.New("kube: no certificate in CA data")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &Client{
+		config: config,
+		http:   http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+	}, nil
+}
+
+// get requests path and returns the body of a successful response.
+func (c *Client) get(ctx context.Context, path string, query url.Values) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.Host+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.config.TokenFile != "" {
+		token, err := os.ReadFile(c.config.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&status)
+		return nil, &Error{StatusCode: resp.StatusCode, Message: status.Message}
+	}
+	return resp.Body, nil
+}
+
+// getJson requests path and decodes the response into v.
+func (c *Client) getJson(path string, query url.Values, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	body, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(v)
+}
+
+func nodeQuery(nodeName string) url.Values {
+	query := url.Values{}
+	query.Set("fieldSelector", "spec.nodeName="+nodeName)
+	return query
+}
+
+// ListPods lists the pods scheduled on nodeName.
+func (c *Client) ListPods(nodeName string) (PodList, error) {
+	var pods PodList
+	err := c.getJson("/api/v1/pods", nodeQuery(nodeName), &pods)
+	return pods, err
+}
+
+// WatchPods calls handle with every change of the pods scheduled on
+// nodeName after resourceVersion, until ctx is done or the API server ends
+// the watch. An expired resourceVersion is reported as an *Error with
+// status 410, after which the pods must be listed again.
+func (c *Client) WatchPods(ctx context.Context, nodeName string, resourceVersion string, handle func(WatchEvent)) error {
+	query := nodeQuery(nodeName)
+	query.Set("watch", "true")
+	query.Set("allowWatchBookmarks", "true")
+	query.Set("resourceVersion", resourceVersion)
+
+	body, err := c.get(ctx, "/api/v1/pods", query)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return err
+		}
+		if event.Type == EventError {
+			var status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &status)
+			return &Error{StatusCode: status.Code, Message: status.Message}
+		}
+		watchEvent := WatchEvent{Type: event.Type}
+		if err := json.Unmarshal(event.Object, &watchEvent.Object); err != nil {
+			return err
+		}
+		handle(watchEvent)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
+
+// GetOwner gets the metadata of the object ref points to, in namespace.
+// Only workload kinds are known.
+func (c *Client) GetOwner(namespace string, ref OwnerReference) (ObjectMeta, error) {
+	path, ok := ownerPaths[ref.Kind]
+	if !ok {
+		return ObjectMeta{}, fmt.Errorf("kube: unknown owner kind %q", ref.Kind)
+	}
+	var object struct {
+		Metadata ObjectMeta `json:"metadata"`
+	}
+	err := c.getJson(fmt.Sprintf(path, url.PathEscape(namespace), url.PathEscape(ref.Name)), nil, &object)
+	return object.Metadata, err
+}
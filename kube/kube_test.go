@@ -0,0 +1,102 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"container-agent/fakehost"
+)
+
+func TestClient(t *testing.T) {
+	h := fakehost.New(t)
+	srv := &fakehost.KubeServer{
+		Token: "secret",
+		Pods: []fakehost.KubePod{
+			{Name: "api-7d9f-x2", Namespace: "payments", Uid: "uid-1", NodeName: "node-1", ServiceAccount: "api",
+				Owner:      &fakehost.KubeOwner{Kind: "ReplicaSet", Name: "api-7d9f"},
+				Containers: []fakehost.KubeContainer{{Name: "api", Requests: map[string]string{"cpu": "250m"}, Limits: map[string]string{"memory": "256Mi"}}}},
+			{Name: "other", Namespace: "payments", Uid: "uid-2", NodeName: "node-2"},
+		},
+		Objects: []fakehost.KubeObject{{Kind: "ReplicaSet", Namespace: "payments", Name: "api-7d9f", Owner: &fakehost.KubeOwner{Kind: "Deployment", Name: "api"}}},
+	}
+	config, err := InClusterConfig(h.ServeKube(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pods, err := client.ListPods("node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 || pods.Items[0].Metadata.Uid != "uid-1" || pods.Items[0].Spec.ServiceAccountName != "api" {
+		t.Fatalf("got %+v", pods.Items)
+	}
+	container, ok := pods.Items[0].Container("api")
+	if !ok || container.Resources.Requests["cpu"] != "250m" || container.Resources.Limits["memory"] != "256Mi" {
+		t.Errorf("got %+v", container)
+	}
+
+	ref, ok := pods.Items[0].Metadata.ControllerRef()
+	if !ok || ref.Kind != "ReplicaSet" || ref.Name != "api-7d9f" {
+		t.Fatalf("got %+v", ref)
+	}
+	owner, err := client.GetOwner("payments", ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment, ok := owner.ControllerRef(); !ok || deployment.Kind != "Deployment" || deployment.Name != "api" {
+		t.Errorf("got %+v", owner)
+	}
+	if _, err := client.GetOwner("payments", OwnerReference{Kind: "Job", Name: "gone"}); !IsNotFound(err) {
+		t.Errorf("got %v, want not found", err)
+	}
+
+	// The watch starts after the list and ends with ctx.
+	srv.Update(EventModified, fakehost.KubePod{Name: "api-7d9f-x2", Namespace: "payments", Uid: "uid-1", NodeName: "node-1", Labels: map[string]string{"app": "api"}})
+	srv.Update(EventAdded, fakehost.KubePod{Name: "elsewhere", Namespace: "payments", Uid: "uid-3", NodeName: "node-2"})
+	srv.Update(EventDeleted, fakehost.KubePod{Name: "api-7d9f-x2", Namespace: "payments", Uid: "uid-1", NodeName: "node-1"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []WatchEvent
+	err = client.WatchPods(ctx, "node-1", pods.Metadata.ResourceVersion, func(event WatchEvent) {
+		events = append(events, event)
+		if len(events) == 2 {
+			cancel()
+		}
+	})
+	if err != context.Canceled {
+		t.Errorf("got %v, want canceled", err)
+	}
+	if len(events) != 2 || events[0].Type != EventModified || events[0].Object.Metadata.Labels["app"] != "api" || events[1].Type != EventDeleted {
+		t.Errorf("got %+v", events)
+	}
+}
+
+func TestClientUnauthorized(t *testing.T) {
+	h := fakehost.New(t)
+	config, err := InClusterConfig(h.ServeKube(&fakehost.KubeServer{Token: "secret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.WriteFile("serviceaccount/token", "expired")
+	client, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ListPods("node-1"); err == nil || err.(*Error).StatusCode != 401 {
+		t.Errorf("got %v, want 401", err)
+	}
+}
+
+func TestInClusterConfigOutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := InClusterConfig(t.TempDir()); err == nil {
+		t.Error("got no error outside of a cluster")
+	}
+}
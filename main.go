@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -9,6 +10,9 @@ import (
 	"syscall"
 	"time"
 
+	"container-agent/cnproc"
+	"container-agent/config"
+	"container-agent/kube"
 	"container-agent/module"
 	httpServer "container-agent/server/http"
 
@@ -28,6 +32,13 @@ func printUsage() {
 func main() {
 	// flags
 	httpPort := pflag.Uint16P("port", "P", 8080, "HTTP API Port")
+	configFile := pflag.StringP("config", "c", "", "Config file (JSON)")
+	hostRoot := pflag.String("host-root", config.Default().HostRoot, "Directory the host filesystems are mounted at")
+	outputDir := pflag.String("output-dir", config.Default().OutputDir, "Directory the monitoring results are written to")
+	captureEnviron := pflag.Bool("capture-environ", config.Default().CaptureEnviron, "Capture the environment of every process, redacted")
+	criEndpoint := pflag.String("cri-endpoint", config.Default().CriEndpoint, "CRI socket to ask for container metadata, instead of the discovered ones")
+	kubernetes := pflag.Bool("kubernetes", config.Default().Kubernetes, "Watch the node's pods through the Kubernetes API for their workloads")
+	procConnector := pflag.Bool("proc-connector", config.Default().ProcConnector, "Collect fork, exec and exit events from the netlink proc connector")
 
 	pflag.ErrHelp = errors.New("")
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
@@ -38,6 +49,70 @@ func main() {
 		printUsage()
 		os.Exit(1)
 	}
+	// config: file first, flags given on the command line win
+	cfg := config.Default()
+	if *configFile != "" {
+		var err error
+		cfg, err = config.Load(*configFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	if pflag.CommandLine.Changed("host-root") {
+		cfg.HostRoot = *hostRoot
+	}
+	if pflag.CommandLine.Changed("output-dir") {
+		cfg.OutputDir = *outputDir
+	}
+	if pflag.CommandLine.Changed("proc-connector") {
+		cfg.ProcConnector = *procConnector
+	}
+	if pflag.CommandLine.Changed("capture-environ") {
+		cfg.CaptureEnviron = *captureEnviron
+	}
+	if pflag.CommandLine.Changed("cri-endpoint") {
+		cfg.CriEndpoint = *criEndpoint
+	}
+	if pflag.CommandLine.Changed("kubernetes") {
+		cfg.Kubernetes = *kubernetes
+	}
+	module.Configure(cfg.HostRoot, cfg.OutputDir)
+	// grpc client, the state files are read when no CRI socket answers
+	module.ConfigureCri(cfg.CriEndpoint)
+	if err := module.ConfigureCapture(cfg.CaptureEnviron, cfg.RedactPatterns); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: redactPatterns: %s\n", err.Error())
+		os.Exit(1)
+	}
+	// proc connector, polling alone still works without it
+	if cfg.ProcConnector {
+		source, err := cnproc.Listen()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: proc connector: %s\n", err.Error())
+		} else {
+			defer source.Close()
+			go func() {
+				err := module.RunProcConnector(source)
+				fmt.Fprintf(os.Stderr, "Error: proc connector: %s\n", err.Error())
+			}()
+		}
+	}
+	// kubernetes API, containers are attributed to pods alone without it
+	if cfg.Kubernetes {
+		kubeConfig, err := kube.InClusterConfig(kube.DefaultServiceAccountDir)
+		var client *kube.Client
+		if err == nil {
+			client, err = kube.New(kubeConfig)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: kubernetes: %s\n", err.Error())
+		} else {
+			go func() {
+				err := module.RunKubeWatcher(context.Background(), client, os.Getenv("CSA_NODE_NAME"))
+				fmt.Fprintf(os.Stderr, "Error: kubernetes: %s\n", err.Error())
+			}()
+		}
+	}
 	// cron
 	cronScheduler := gocron.NewScheduler(time.Local)
 	delayTime := time.Now().Add(5 * time.Second)
@@ -49,7 +124,7 @@ func main() {
 	cronScheduler.StartAsync()
 	defer cronScheduler.Stop()
 	// http server
-	hServer, err := httpServer.Start(*httpPort, log.INFO)
+	hServer, err := httpServer.Start(*httpPort, cfg.OutputDir, log.INFO)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
 		return
@@ -60,8 +135,6 @@ func main() {
 	}
 	defer hServer.Stop()
 
-	// grpc client
-
 	// signal
 	sigs := make(chan os.Signal, 1)
 	done := make(chan bool, 1)
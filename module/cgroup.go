@@ -0,0 +1,330 @@
+package module
+
+import (
+	"bufio"
+	"container-agent/procfs"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CgroupStats are the limits and usage of a container's cgroup. Limits that
+// are not set, and counters the host doesn't have, are reported as -1.
+// OomKills counts the processes the OOM killer picked in the cgroup.
+type CgroupStats struct {
+	Version       int    `json:"Version"`
+	Path          string `json:"Path"`
+	MemoryLimit   int64  `json:"MemoryLimit"`
+	MemoryUsage   int64  `json:"MemoryUsage"`
+	OomKills      int64  `json:"OomKills"`
+	CpuQuota      int64  `json:"CpuQuota"`
+	CpuPeriod     int64  `json:"CpuPeriod"`
+	NrPeriods     int64  `json:"NrPeriods"`
+	NrThrottled   int64  `json:"NrThrottled"`
+	ThrottledUsec int64  `json:"ThrottledUsec"`
+	PidsLimit     int64  `json:"PidsLimit"`
+	PidsCurrent   int64  `json:"PidsCurrent"`
+}
+
+// IsCgroupV2 reports whether the host mounts the unified hierarchy only.
+func IsCgroupV2() bool {
+	_, err := os.Stat(cgroupRoot + "/cgroup.controllers")
+	return err == nil
+}
+
+// cgroupPathMap maps each controller of a process to its cgroup path. The
+// unified (v2) hierarchy is stored under the "" key, and v1 hierarchies
+// under each of their controllers as well as under the comma joined name,
+// which is the directory the host mounts them at.
+func cgroupPathMap(cgroups []procfs.Cgroup) map[string]string {
+	cgroupPaths := make(map[string]string)
+
+	for _, cgroup := range cgroups {
+		cgroupPaths[strings.Join(cgroup.Controllers, ",")] = cgroup.Path
+		for _, controller := range cgroup.Controllers {
+			cgroupPaths[controller] = cgroup.Path
+		}
+	}
+
+	return cgroupPaths
+}
+
+// cgroupDirIndex maps cgroup directory names to their full path below
+// cgroupRoot. It is built lazily by resolveCgroupDir and dropped at the
+// start of every GetContainerInfo run, as containers come and go.
+var cgroupDirIndex map[string]string
+
+// resolveCgroupDir returns the directory of cgroupPath below hierarchy.
+//
+// /proc/[pid]/cgroup is rendered relative to the cgroup namespace of the
+// reader. When the agent runs in its own cgroup namespace the paths of other
+// containers start with "/.." and can't be joined to the mount point, so the
+// leaf, which is unique per container, is looked up in the tree instead.
+func resolveCgroupDir(hierarchy string, cgroupPath string) string {
+	if cgroupPath == "" {
+		return ""
+	}
+	hierarchyRoot := filepath.Join(cgroupRoot, hierarchy)
+	if !strings.HasPrefix(cgroupPath, "/..") {
+		return filepath.Join(hierarchyRoot, cgroupPath)
+	}
+
+	if cgroupDirIndex == nil {
+		cgroupDirIndex = make(map[string]string)
+	}
+	key := hierarchy + ":" + path.Base(cgroupPath)
+	if dir, ok := cgroupDirIndex[key]; ok {
+		return dir
+	}
+
+	// v1 hierarchies mounted for several controllers are reached through
+	// symlinks such as cpu -> cpu,cpuacct, which WalkDir won't descend.
+	if realRoot, err := filepath.EvalSymlinks(hierarchyRoot); err == nil {
+		hierarchyRoot = realRoot
+	}
+	filepath.WalkDir(hierarchyRoot, func(dir string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		cgroupDirIndex[hierarchy+":"+d.Name()] = dir
+		return nil
+	})
+
+	return cgroupDirIndex[key]
+}
+
+func readCgroupValue(filePath string) (int64, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return -1, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return -1, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func readCgroupKeyValues(filePath string) (map[string]int64, error) {
+	values := make(map[string]int64)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return values, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		splitLine := strings.Fields(scanner.Text())
+		if len(splitLine) != 2 {
+			continue
+		}
+		value, err := strconv.ParseInt(splitLine[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[splitLine[0]] = value
+	}
+	if scanner.Err() != nil {
+		return values, scanner.Err()
+	}
+
+	return values, nil
+}
+
+// readOomKills reads the oom_kill counter of a cgroup, from memory.events
+// on v2 and memory.oom_control on v1. The v1 counter needs Linux 4.13.
+func readOomKills(dir string, file string) (int64, error) {
+	values, err := readCgroupKeyValues(dir + "/" + file)
+	if err != nil {
+		return -1, err
+	}
+	oomKills, ok := values["oom_kill"]
+	if !ok {
+		return -1, fmt.Errorf("no oom_kill in %s", file)
+	}
+	return oomKills, nil
+}
+
+// GetCgroupStats reads the limits and usage of the cgroups a process lives
+// in. Files missing on the host (e.g. no pids controller) leave their
+// values at -1.
+func GetCgroupStats(cgroups []procfs.Cgroup) (CgroupStats, error) {
+	cgroupStats := CgroupStats{
+		MemoryLimit:   -1,
+		MemoryUsage:   -1,
+		OomKills:      -1,
+		CpuQuota:      -1,
+		CpuPeriod:     -1,
+		NrPeriods:     -1,
+		NrThrottled:   -1,
+		ThrottledUsec: -1,
+		PidsLimit:     -1,
+		PidsCurrent:   -1,
+	}
+
+	if len(cgroups) == 0 {
+		return cgroupStats, fmt.Errorf("no cgroups")
+	}
+	cgroupPaths := cgroupPathMap(cgroups)
+
+	if IsCgroupV2() {
+		cgroupStats.Version = 2
+		cgroupStats.Path = cgroupPaths[""]
+		dir := resolveCgroupDir("", cgroupPaths[""])
+		if dir == "" {
+			return cgroupStats, nil
+		}
+
+		cgroupStats.MemoryLimit, _ = readCgroupValue(dir + "/memory.max")
+		cgroupStats.MemoryUsage, _ = readCgroupValue(dir + "/memory.current")
+		if oomKills, err := readOomKills(dir, "memory.events"); err == nil {
+			cgroupStats.OomKills = oomKills
+		}
+		if content, err := ioutil.ReadFile(dir + "/cpu.max"); err == nil {
+			splitContent := strings.Fields(string(content))
+			if len(splitContent) == 2 {
+				if splitContent[0] != "max" {
+					cgroupStats.CpuQuota, _ = strconv.ParseInt(splitContent[0], 10, 64)
+				}
+				cgroupStats.CpuPeriod, _ = strconv.ParseInt(splitContent[1], 10, 64)
+			}
+		}
+		if cpuStat, err := readCgroupKeyValues(dir + "/cpu.stat"); err == nil {
+			cgroupStats.NrPeriods = cpuStat["nr_periods"]
+			cgroupStats.NrThrottled = cpuStat["nr_throttled"]
+			cgroupStats.ThrottledUsec = cpuStat["throttled_usec"]
+		}
+		cgroupStats.PidsLimit, _ = readCgroupValue(dir + "/pids.max")
+		cgroupStats.PidsCurrent, _ = readCgroupValue(dir + "/pids.current")
+
+		return cgroupStats, nil
+	}
+
+	cgroupStats.Version = 1
+	cgroupStats.Path = cgroupPaths["memory"]
+
+	if dir := resolveCgroupDir("memory", cgroupPaths["memory"]); dir != "" {
+		cgroupStats.MemoryLimit, _ = readCgroupValue(dir + "/memory.limit_in_bytes")
+		// An unlimited v1 cgroup reports PAGE_COUNTER_MAX rounded to pages.
+		if cgroupStats.MemoryLimit >= 0x7FFFFFFFFFFFF000 {
+			cgroupStats.MemoryLimit = -1
+		}
+		cgroupStats.MemoryUsage, _ = readCgroupValue(dir + "/memory.usage_in_bytes")
+		if oomKills, err := readOomKills(dir, "memory.oom_control"); err == nil {
+			cgroupStats.OomKills = oomKills
+		}
+	}
+	if dir := resolveCgroupDir("cpu", cgroupPaths["cpu"]); dir != "" {
+		cgroupStats.CpuQuota, _ = readCgroupValue(dir + "/cpu.cfs_quota_us")
+		cgroupStats.CpuPeriod, _ = readCgroupValue(dir + "/cpu.cfs_period_us")
+		if cpuStat, err := readCgroupKeyValues(dir + "/cpu.stat"); err == nil {
+			cgroupStats.NrPeriods = cpuStat["nr_periods"]
+			cgroupStats.NrThrottled = cpuStat["nr_throttled"]
+			cgroupStats.ThrottledUsec = cpuStat["throttled_time"] / 1000
+		}
+	}
+	if dir := resolveCgroupDir("pids", cgroupPaths["pids"]); dir != "" {
+		cgroupStats.PidsLimit, _ = readCgroupValue(dir + "/pids.max")
+		cgroupStats.PidsCurrent, _ = readCgroupValue(dir + "/pids.current")
+	}
+
+	return cgroupStats, nil
+}
+
+// GetOomKills reads the oom_kill counter of the memory cgroup a process
+// lives in.
+func GetOomKills(cgroups []procfs.Cgroup) (int64, error) {
+	cgroupPaths := cgroupPathMap(cgroups)
+
+	hierarchy, file := "memory", "memory.oom_control"
+	if IsCgroupV2() {
+		hierarchy, file = "", "memory.events"
+	}
+	dir := resolveCgroupDir(hierarchy, cgroupPaths[hierarchy])
+	if dir == "" {
+		return -1, fmt.Errorf("no memory cgroup")
+	}
+	return readOomKills(dir, file)
+}
+
+// containerCgroupPrefixes maps the scope prefixes the systemd cgroup driver
+// (and cri-o with cgroupfs) puts in front of a container ID to the runtime
+// that created it.
+var containerCgroupPrefixes = []struct {
+	prefix  string
+	runtime string
+}{
+	{"cri-containerd-", "containerd"},
+	{"docker-", "docker"},
+	{"crio-", "crio"},
+}
+
+func isContainerIdString(id string) bool {
+	if len(id) != 64 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// parseContainerCgroupPath extracts the container ID from a single cgroup
+// path, walking it from the leaf up so sub-cgroups a container creates
+// below its own (e.g. ".../docker-<id>.scope/init.scope") are skipped.
+// Both driver layouts are understood:
+//
+//	systemd:  /kubepods.slice/.../cri-containerd-<id>.scope
+//	cgroupfs: /kubepods/burstable/pod<uid>/<id>, /docker/<id>
+//
+// runtime is empty if the cgroupfs layout doesn't tell the runtime apart.
+func parseContainerCgroupPath(cgroupPath string) (string, string) {
+	splitPath := strings.Split(cgroupPath, "/")
+	for i := len(splitPath) - 1; i >= 0; i-- {
+		name := strings.TrimSuffix(splitPath[i], ".scope")
+		if strings.HasPrefix(name, "crio-conmon-") {
+			// conmon is cri-o's shim, it runs on behalf of the host.
+			return "", ""
+		}
+		for _, containerPrefix := range containerCgroupPrefixes {
+			if strings.HasPrefix(name, containerPrefix.prefix) && isContainerIdString(name[len(containerPrefix.prefix):]) {
+				return name[len(containerPrefix.prefix):], containerPrefix.runtime
+			}
+		}
+		if isContainerIdString(name) {
+			if i > 0 && splitPath[i-1] == "docker" {
+				return name, "docker"
+			}
+			return name, ""
+		}
+	}
+	return "", ""
+}
+
+// GetContainerCgroup returns the container ID and runtime a process
+// belongs to according to its cgroups. The unified hierarchy is preferred,
+// the v1 hierarchies are tried in a fixed order so the result is stable.
+func GetContainerCgroup(cgroups []procfs.Cgroup) (string, string) {
+	cgroupPaths := cgroupPathMap(cgroups)
+
+	for _, controller := range []string{"", "memory", "cpu", "pids", "name=systemd", "devices"} {
+		cgroupPath, ok := cgroupPaths[controller]
+		if !ok {
+			continue
+		}
+		if containerId, runtime := parseContainerCgroupPath(cgroupPath); containerId != "" {
+			return containerId, runtime
+		}
+	}
+
+	return "", ""
+}
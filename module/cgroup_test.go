@@ -0,0 +1,122 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"container-agent/fakehost"
+	"container-agent/procfs"
+)
+
+var (
+	limitedCgroup = fakehost.Cgroup{Path: "/kubepods/burstable/pod1/" + containerIdOf('a'),
+		MemoryLimit: 256 << 20, MemoryUsage: 64 << 20, OomKills: 2, CpuQuota: 50000, CpuPeriod: 100000,
+		NrPeriods: 1000, NrThrottled: 40, ThrottledUsec: 2500000, PidsLimit: 100, PidsCurrent: 7}
+	unlimitedCgroup = fakehost.Cgroup{Path: "/kubepods/besteffort/pod2/" + containerIdOf('b'),
+		MemoryLimit: -1, MemoryUsage: 10 << 20, CpuQuota: -1, CpuPeriod: 100000, PidsLimit: -1, PidsCurrent: 3}
+)
+
+// addCgroup writes c in the layout of version and returns the
+// /proc/[pid]/cgroup content of its processes.
+func addCgroup(h *fakehost.Host, version int, c fakehost.Cgroup) string {
+	if version == 2 {
+		return h.AddCgroupV2(c)
+	}
+	return h.AddCgroupV1(c)
+}
+
+func TestGetCgroupStats(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			h := newHost(t)
+			limited := addCgroup(h, version, limitedCgroup)
+			unlimited := addCgroup(h, version, unlimitedCgroup)
+
+			for _, tc := range []struct {
+				cgroup string
+				want   CgroupStats
+			}{
+				{limited, CgroupStats{Version: version, Path: limitedCgroup.Path,
+					MemoryLimit: 256 << 20, MemoryUsage: 64 << 20, OomKills: 2, CpuQuota: 50000, CpuPeriod: 100000,
+					NrPeriods: 1000, NrThrottled: 40, ThrottledUsec: 2500000, PidsLimit: 100, PidsCurrent: 7}},
+				{unlimited, CgroupStats{Version: version, Path: unlimitedCgroup.Path,
+					MemoryLimit: -1, MemoryUsage: 10 << 20, OomKills: 0, CpuQuota: -1, CpuPeriod: 100000,
+					NrPeriods: 0, NrThrottled: 0, ThrottledUsec: 0, PidsLimit: -1, PidsCurrent: 3}},
+			} {
+				got, err := GetCgroupStats(procfs.ParseCgroups([]byte(tc.cgroup)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tc.want {
+					t.Errorf("got %+v, want %+v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetContainerInfo(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			h := newHost(t)
+			limitedId, unlimitedId := containerIdOf('a'), containerIdOf('b')
+			limited := addCgroup(h, version, limitedCgroup)
+			unlimited := addCgroup(h, version, unlimitedCgroup)
+
+			h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}})
+			h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Cmdline: []string{"java"}, Cgroup: limited})
+			h.AddProcess(fakehost.Process{Pid: 101, PPid: 100, Cmdline: []string{"java"}, Cgroup: limited})
+			h.AddProcess(fakehost.Process{Pid: 200, PPid: 1, Cmdline: []string{"redis-server"}, Cgroup: unlimited})
+			refMap := map[int]ContainerRef{1: hostRef, 100: podRef("api", limitedId), 101: podRef("api", limitedId), 200: podRef("cache", unlimitedId)}
+
+			procs, err := procFS.AllProcs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			cpuList := make([]CpuUsage, len(procs))
+			memList := make([]MemUsage, len(procs))
+			for i, proc := range procs {
+				switch proc.Pid {
+				case 100:
+					cpuList[i], memList[i] = CpuUsage{PerCore: 20, Node: 10}, MemUsage{Rss: 40 << 20, Pss: 30 << 20}
+				case 101:
+					cpuList[i], memList[i] = CpuUsage{PerCore: 10, Node: 5}, MemUsage{Rss: 24 << 20, Pss: 20 << 20, Swap: 1 << 20}
+				case 200:
+					cpuList[i], memList[i] = CpuUsage{PerCore: 5, Node: 2.5}, MemUsage{Rss: 8 << 20}
+				}
+			}
+
+			containerInfoJson, err := GetContainerInfo(procs, cpuList, memList, make([]IoUsage, len(procs)), make([]ExeInfo, len(procs)), refMap, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var containerInfo []ContainerInfo
+			if err := json.Unmarshal([]byte(containerInfoJson), &containerInfo); err != nil {
+				t.Fatal(err)
+			}
+
+			type summary struct {
+				ContainerId                               string
+				CpuUsage, NodeCpuUsage, CpuLimitUsage     string
+				MemRss, MemPss, MemSwap, MemoryLimitUsage string
+				ProcessIds                                []string
+				CgroupVersion                             int
+			}
+			var got []summary
+			for _, info := range containerInfo {
+				got = append(got, summary{info.ContainerId, info.CpuUsage, info.NodeCpuUsage, info.CpuLimitUsage,
+					info.MemRss, info.MemPss, info.MemSwap, info.MemoryLimitUsage, info.ProcessIds, info.Cgroup.Version})
+			}
+			// By CPU usage. 30% of the half core allowed, 64MB of 256MB used.
+			want := []summary{
+				{limitedId, "30.000%", "15.000%", "60.000%", "64.0MB", "50.0MB", "1.0MB", "25.000%", []string{"100", "101"}, version},
+				{unlimitedId, "5.000%", "2.500%", "-", "8.0MB", "0.0MB", "0.0MB", "-", []string{"200"}, version},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
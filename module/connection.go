@@ -0,0 +1,119 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// ConnectionInfo is a socket and the processes holding it. Sockets no
+// process holds (e.g. in TIME_WAIT) are attributed to the owner of the
+// network namespace they were found in.
+type ConnectionInfo struct {
+	Protocol      string   `json:"Protocol"`
+	State         string   `json:"State"`
+	LocalAddress  string   `json:"LocalAddress"`
+	RemoteAddress string   `json:"RemoteAddress"`
+	Path          string   `json:"Path,omitempty"`
+	Inode         uint64   `json:"Inode"`
+	ProcessName   string   `json:"ProcessName"`
+	ProcessIds    []string `json:"ProcessIds"`
+	ContainerRef
+}
+
+// GetConnectionInfo reads the socket tables once per network namespace
+// and maps every socket to the processes holding it through their fds.
+func GetConnectionInfo(procs []procfs.Proc, refMap map[int]ContainerRef) (string, error) {
+	inodePids := make(map[uint64][]int)
+	names := make(map[int]string, len(procs))
+	netNamespaces := make(map[uint64][]int)
+	var netNamespaceOrder []uint64
+
+	for _, proc := range procs {
+		names[proc.Pid] = proc.Stat.Comm
+
+		inodes, err := procFS.SocketInodes(proc.Pid)
+		if err != nil {
+			continue
+		}
+		for _, inode := range inodes {
+			inodePids[inode] = append(inodePids[inode], proc.Pid)
+		}
+
+		// Processes whose namespace can't be read get their own tables;
+		// sockets are deduplicated by inode below anyway.
+		netNamespace := proc.Namespaces["net"]
+		if netNamespace == 0 {
+			netNamespace = ^(uint64)(proc.Pid)
+		}
+		if _, ok := netNamespaces[netNamespace]; !ok {
+			netNamespaceOrder = append(netNamespaceOrder, netNamespace)
+		}
+		netNamespaces[netNamespace] = append(netNamespaces[netNamespace], proc.Pid)
+	}
+
+	connectionInfo := make([]ConnectionInfo, 0)
+	seen := make(map[uint64]bool)
+
+	for _, netNamespace := range netNamespaceOrder {
+		// Any process of the namespace will do, the first one may have
+		// exited since.
+		var sockets []procfs.Socket
+		var reader int
+		for _, pid := range netNamespaces[netNamespace] {
+			var err error
+			sockets, err = procFS.NetSockets(pid)
+			if err == nil {
+				reader = pid
+				break
+			}
+		}
+
+		for _, socket := range sockets {
+			if socket.Inode != 0 {
+				if seen[socket.Inode] {
+					continue
+				}
+				seen[socket.Inode] = true
+			}
+
+			connection := ConnectionInfo{
+				Protocol:      socket.Protocol,
+				State:         socket.State,
+				LocalAddress:  socket.LocalAddress,
+				RemoteAddress: socket.RemoteAddress,
+				Path:          socket.Path,
+				Inode:         socket.Inode,
+				ProcessIds:    make([]string, 0),
+			}
+
+			owner := reader
+			if pids, ok := inodePids[socket.Inode]; ok && socket.Inode != 0 {
+				owner = pids[0]
+				connection.ProcessName = names[owner]
+				for _, pid := range pids {
+					connection.ProcessIds = append(connection.ProcessIds, strconv.Itoa(pid))
+				}
+			}
+			connection.ContainerRef = refMap[owner]
+
+			connectionInfo = append(connectionInfo, connection)
+		}
+	}
+
+	sort.SliceStable(connectionInfo, func(i, j int) bool {
+		a, b := connectionInfo[i], connectionInfo[j]
+		if a.PodName != b.PodName {
+			return a.PodName < b.PodName
+		}
+		return a.Protocol < b.Protocol
+	})
+
+	jsonData, err := json.MarshalIndent(connectionInfo, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
@@ -0,0 +1,39 @@
+package module
+
+import (
+	"testing"
+
+	"container-agent/fakehost"
+)
+
+func TestGetConnectionInfo(t *testing.T) {
+	h := newHost(t)
+
+	tcp := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0 100 0 0 10 0\n" +
+		"   1: 0100007F:0050 0100007F:D431 01 00000000:00000000 00:00000000 00000000   101        0 1002 1 0 20 4 30 10 -1\n" +
+		"   2: 0100007F:0050 0100007F:D432 06 00000000:00000000 03:00000F1A 00000000     0        0 0 3 0\n"
+	tcp6 := "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n" +
+		"   0: 00000000000000000000000001000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 2001 1 0 100 0 0 10 0\n"
+	unix := "Num       RefCount Protocol Flags    Type St Inode Path\n" +
+		"0000000000000000: 00000002 00000000 00010000 0001 01 3001 /run/app.sock\n"
+
+	h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}, Namespaces: map[string]uint64{"net": 1},
+		Net: map[string]string{"tcp": "  sl  local_address\n", "tcp6": tcp6}, Fds: []string{"/dev/null", "socket:[2001]"}})
+	h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Cmdline: []string{"nginx"}, Namespaces: map[string]uint64{"net": 2},
+		Net: map[string]string{"tcp": tcp, "unix": unix}, Fds: []string{"socket:[1001]", "socket:[3001]"}})
+	h.AddProcess(fakehost.Process{Pid: 101, PPid: 100, Cmdline: []string{"nginx"}, Namespaces: map[string]uint64{"net": 2},
+		Net: map[string]string{"tcp": tcp, "unix": unix}, Fds: []string{"socket:[1001]", "socket:[1002]"}})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refMap := map[int]ContainerRef{1: hostRef, 100: podRef("web", containerIdOf('a')), 101: podRef("web", containerIdOf('a'))}
+
+	connectionInfo, err := GetConnectionInfo(procs, refMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "connections", connectionInfo+"\n")
+}
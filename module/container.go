@@ -0,0 +1,140 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ContainerInfo is the sum of the processes attributed to a container,
+// next to the limits of its cgroup. DriftProcessIds are the processes
+// running a binary that was not in the container's image.
+type ContainerInfo struct {
+	ContainerRef
+	Metadata         ContainerMetadata   `json:"Metadata"`
+	Kubernetes       *KubernetesInfo     `json:"Kubernetes,omitempty"`
+	ProcessCount     int                 `json:"ProcessCount"`
+	ProcessIds       []string            `json:"ProcessIds"`
+	CpuUsage         string              `json:"CpuUsage"`
+	NodeCpuUsage     string              `json:"NodeCpuUsage"`
+	CpuLimitUsage    string              `json:"CpuLimitUsage"`
+	MemRss           string              `json:"MemoryRss"`
+	MemPss           string              `json:"MemoryPss"`
+	MemSwap          string              `json:"MemorySwap"`
+	MemoryLimitUsage string              `json:"MemoryLimitUsage"`
+	Io               IoRates             `json:"Io"`
+	DriftProcessIds  []string            `json:"DriftProcessIds"`
+	Cgroup           CgroupStats         `json:"Cgroup"`
+	Security         ContainerSecurity   `json:"Security"`
+	Namespaces       ContainerNamespaces `json:"Namespaces"`
+}
+
+type containerTotal struct {
+	ref       ContainerRef
+	procs     []procfs.Proc
+	cpuUsage  CpuUsage
+	memUsage  MemUsage
+	ioUsage   IoUsage
+	driftPids []string
+}
+
+// formatLimitUsage returns usage as a percentage of limit, or "-" if the
+// container has no limit.
+func formatLimitUsage(usage float64, limit float64) string {
+	if limit <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.3f%%", 100.0*usage/limit)
+}
+
+func GetContainerInfo(procs []procfs.Proc, cpuList []CpuUsage, memList []MemUsage, ioList []IoUsage, exeList []ExeInfo, refMap map[int]ContainerRef, metadataMap map[string]ContainerMetadata) (string, error) {
+	totals := make(map[string]*containerTotal)
+	var names []string
+
+	cgroupDirIndex = nil
+	hostNamespaces := getHostNamespaces(procs)
+
+	for i := 0; i < len(procs); i++ {
+		pid := procs[i].Pid
+		ref := refMap[pid]
+		if ref.IsHost() {
+			continue
+		}
+
+		total, ok := totals[ref.ContainerId]
+		if !ok {
+			total = &containerTotal{ref: ref}
+			totals[ref.ContainerId] = total
+			names = append(names, ref.ContainerId)
+		}
+		total.procs = append(total.procs, procs[i])
+		total.cpuUsage.PerCore += cpuList[i].PerCore
+		total.cpuUsage.Node += cpuList[i].Node
+		total.memUsage.Rss += memList[i].Rss
+		total.memUsage.Pss += memList[i].Pss
+		total.memUsage.Swap += memList[i].Swap
+		total.ioUsage.add(ioList[i])
+		if exeList[i].IsDrift() {
+			total.driftPids = append(total.driftPids, strconv.Itoa(pid))
+		}
+	}
+
+	sort.SliceStable(names, func(i, j int) bool {
+		return totals[names[i]].cpuUsage.PerCore > totals[names[j]].cpuUsage.PerCore
+	})
+
+	containerInfo := make([]ContainerInfo, 0, len(names))
+	for _, name := range names {
+		total := totals[name]
+
+		// Every process of a container shares its cgroup, so any of them
+		// will do. Kernel threads and zombies have none, so try them in turn.
+		var cgroupStats CgroupStats
+		for _, proc := range total.procs {
+			var err error
+			cgroupStats, err = GetCgroupStats(proc.Cgroups)
+			if err == nil {
+				break
+			}
+		}
+
+		pids := make([]string, 0, len(total.procs))
+		for _, proc := range total.procs {
+			pids = append(pids, strconv.Itoa(proc.Pid))
+		}
+
+		var cpuLimit float64
+		if cgroupStats.CpuQuota > 0 && cgroupStats.CpuPeriod > 0 {
+			cpuLimit = 100.0 * (float64)(cgroupStats.CpuQuota) / (float64)(cgroupStats.CpuPeriod)
+		}
+
+		containerInfo = append(containerInfo, ContainerInfo{
+			ContainerRef:     total.ref,
+			Metadata:         getContainerMetadata(total.ref.ContainerId, total.ref.Runtime, metadataMap),
+			Kubernetes:       getKubernetesInfo(total.ref),
+			ProcessCount:     len(pids),
+			ProcessIds:       pids,
+			CpuUsage:         fmt.Sprintf("%.3f%%", total.cpuUsage.PerCore),
+			NodeCpuUsage:     fmt.Sprintf("%.3f%%", total.cpuUsage.Node),
+			CpuLimitUsage:    formatLimitUsage((float64)(total.cpuUsage.PerCore), cpuLimit),
+			MemRss:           formatMB(total.memUsage.Rss),
+			MemPss:           formatMB(total.memUsage.Pss),
+			MemSwap:          formatMB(total.memUsage.Swap),
+			MemoryLimitUsage: formatLimitUsage((float64)(cgroupStats.MemoryUsage), (float64)(cgroupStats.MemoryLimit)),
+			Io:               newIoRates(total.ioUsage),
+			DriftProcessIds:  append(make([]string, 0), total.driftPids...),
+			Cgroup:           cgroupStats,
+			Security:         GetContainerSecurity(total.procs),
+			Namespaces:       GetContainerNamespaces(total.procs, hostNamespaces),
+		})
+	}
+
+	jsonData, err := json.MarshalIndent(containerInfo, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
@@ -0,0 +1,154 @@
+package module
+
+import (
+	"container-agent/docker"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dockerEngineSocket is where dockerd serves the Engine API on the host.
+// cri-dockerd serves CRI on a socket of its own.
+const dockerEngineSocket = "/run/docker.sock"
+
+// dockerInspectCache keeps the container and image inspects of the last
+// Monitoring() run. Images are immutable, containers are inspected again
+// after any event of theirs since until.
+type dockerInspectCache struct {
+	containers map[string]docker.Container
+	images     map[string]docker.Image
+	until      time.Time
+}
+
+var dockerCache dockerInspectCache
+
+// dockerHostPath maps a path below dockerd's data root to its path below
+// hostRoot, where the daemonset mounts /var/lib/docker as /docker.
+func dockerHostPath(path string) string {
+	i := strings.Index(path, "/docker/")
+	if i < 0 {
+		return ""
+	}
+	return hostRoot + path[i:]
+}
+
+// dockerUpperDir returns the overlay upper dir of a container below
+// hostRoot, derived from its merged dir, a sibling, if the graph driver
+// doesn't tell.
+func dockerUpperDir(container docker.Container) string {
+	upperDir := container.GraphDriver.Data["UpperDir"]
+	if upperDir == "" && container.GraphDriver.Data["MergedDir"] != "" {
+		upperDir = filepath.Join(filepath.Dir(container.GraphDriver.Data["MergedDir"]), "diff")
+	}
+	if upperDir == "" {
+		return ""
+	}
+	return dockerHostPath(upperDir)
+}
+
+func newDockerMetadata(container docker.Container, image docker.Image) ContainerMetadata {
+	labels := container.Config.Labels
+	metadata := ContainerMetadata{
+		PodName:        labels["io.kubernetes.pod.name"],
+		PodNamespace:   labels["io.kubernetes.pod.namespace"],
+		PodUid:         labels["io.kubernetes.pod.uid"],
+		SandboxId:      labels["io.kubernetes.sandbox.id"],
+		ContainerName:  labels["io.kubernetes.container.name"],
+		ComposeProject: labels["com.docker.compose.project"],
+		ComposeService: labels["com.docker.compose.service"],
+		Image:          container.Config.Image,
+		ImageDigest:    container.Image,
+		Labels:         labels,
+		RestartCount:   container.RestartCount,
+		Source:         MetadataSourceDocker,
+		runtime:        RuntimeDocker,
+		upperDir:       dockerUpperDir(container),
+	}
+	if metadata.ContainerName == "" {
+		metadata.ContainerName = strings.TrimPrefix(container.Name, "/")
+	}
+	if len(image.RepoDigests) > 0 {
+		metadata.ImageDigest = image.RepoDigests[0]
+	}
+	if restartCount, err := strconv.Atoi(labels["io.kubernetes.container.restartCount"]); err == nil {
+		metadata.RestartCount = restartCount
+	}
+	return metadata
+}
+
+// inspectDockerContainers inspects the running containers and their images,
+// reusing the inspects of the last run that no event invalidated.
+func inspectDockerContainers(client *docker.Client, now time.Time) ([]docker.Container, error) {
+	summaries, err := client.Containers()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := dockerCache.containers
+	if !dockerCache.until.IsZero() {
+		events, err := client.Events(dockerCache.until, now)
+		if err != nil {
+			cached = nil
+		}
+		for _, event := range events {
+			delete(cached, event.Actor.Id)
+		}
+	}
+
+	containers := make([]docker.Container, 0, len(summaries))
+	containerCache := make(map[string]docker.Container, len(summaries))
+	for _, summary := range summaries {
+		container, ok := cached[summary.Id]
+		if !ok {
+			container, err = client.Inspect(summary.Id)
+			if docker.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		containers = append(containers, container)
+		containerCache[summary.Id] = container
+	}
+
+	dockerCache.containers = containerCache
+	dockerCache.until = now
+	return containers, nil
+}
+
+// inspectDockerImage inspects an image once. Images that can't be inspected
+// are asked again next time.
+func inspectDockerImage(client *docker.Client, imageId string, images map[string]docker.Image) docker.Image {
+	if image, ok := dockerCache.images[imageId]; ok {
+		images[imageId] = image
+		return image
+	}
+	image, err := client.InspectImage(imageId)
+	if err == nil {
+		images[imageId] = image
+	}
+	return image
+}
+
+// getDockerMetadata adds the metadata of every running container of the
+// Docker Engine API to metadataMap. It overrides what cri-dockerd told
+// over CRI, the Engine API also has the graph driver's dirs.
+func getDockerMetadata(metadataMap map[string]ContainerMetadata, now time.Time) error {
+	client := docker.New(hostRoot+dockerEngineSocket, docker.DefaultTimeout)
+	defer client.Close()
+
+	containers, err := inspectDockerContainers(client, now)
+	if err != nil {
+		return err
+	}
+
+	images := make(map[string]docker.Image)
+	for _, container := range containers {
+		image := inspectDockerImage(client, container.Image, images)
+		metadataMap[container.Id] = newDockerMetadata(container, image)
+	}
+	dockerCache.images = images
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package module
+
+import (
+	"testing"
+	"time"
+
+	"container-agent/fakehost"
+)
+
+func TestGetDockerMetadata(t *testing.T) {
+	h := newHost(t)
+
+	podId := containerIdOf('a')
+	composeId := containerIdOf('b')
+
+	// Neither container has state files, only the Engine API knows them.
+	srv := &fakehost.DockerServer{
+		Version: "20.10.21",
+		Containers: []fakehost.DockerContainer{
+			{Id: podId, Name: "k8s_nginx_web-0_shop_uid-1_2", Image: "nginx:1.23", ImageId: "sha256:i1", RestartCount: 5,
+				Labels: map[string]string{
+					"io.kubernetes.pod.name": "web-0", "io.kubernetes.pod.namespace": "shop", "io.kubernetes.pod.uid": "uid-1",
+					"io.kubernetes.container.name": "nginx", "io.kubernetes.container.restartCount": "2",
+				},
+				UpperDir: "/var/lib/docker/overlay2/l1/diff", MergedDir: "/var/lib/docker/overlay2/l1/merged"},
+			{Id: composeId, Name: "shop-db-1", Image: "postgres:15", ImageId: "sha256:i2",
+				Labels:    map[string]string{"com.docker.compose.project": "shop", "com.docker.compose.service": "db"},
+				MergedDir: "/var/lib/docker/overlay2/merged-l2/merged"},
+		},
+		Images: []fakehost.DockerImage{{Id: "sha256:i1", RepoDigests: []string{"nginx@sha256:abc"}}},
+	}
+	h.ServeDocker("run/docker.sock", srv)
+	h.AddFiles("docker/overlay2/l1/diff", []string{"tmp/x"})
+
+	h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}})
+	h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Cmdline: []string{"nginx"}, Cgroup: "0::/kubepods/besteffort/poduid-1/" + podId})
+	h.AddProcess(fakehost.Process{Pid: 200, PPid: 1, Cmdline: []string{"postgres"}, Cgroup: "0::/system.slice/docker-" + composeId + ".scope"})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtimes, err := DiscoverRuntimes(procs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runtimes) != 1 || runtimes[0].Name != RuntimeDocker || runtimes[0].Version != "20.10.21" {
+		t.Errorf("got runtimes %+v", runtimes)
+	}
+
+	metadataMap, err := GetContainerMetadata(runtimes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nginx := metadataMap[podId]
+	if nginx.Source != MetadataSourceDocker || nginx.PodName != "web-0" || nginx.PodNamespace != "shop" || nginx.ContainerName != "nginx" ||
+		nginx.Image != "nginx:1.23" || nginx.ImageDigest != "nginx@sha256:abc" || nginx.RestartCount != 2 {
+		t.Errorf("got %+v", nginx)
+	}
+	db := metadataMap[composeId]
+	if db.PodName != "" || db.ContainerName != "shop-db-1" || db.ComposeProject != "shop" || db.ComposeService != "db" ||
+		db.ImageDigest != "sha256:i2" {
+		t.Errorf("got %+v", db)
+	}
+
+	pidMap, _ := GetPidMapper(procs)
+	refMap, _, runtimeMap, err := GetContainerId(procs, pidMap, DefaultRuntime(runtimes), metadataMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refMap[100].String() != "shop/web-0/"+podId || refMap[100].ContainerName != "nginx" || refMap[200].String() != composeId {
+		t.Errorf("got %v", refMap)
+	}
+
+	diffList, err := GetFileSystemDir([]string{podId, composeId}, refMap, runtimeMap, metadataMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diffList[0] != h.Path("docker/overlay2/l1/diff") || diffList[1] != h.Path("docker/overlay2/merged-l2/diff") {
+		t.Errorf("got %v", diffList)
+	}
+
+	// The next run only inspects the containers with events since.
+	srv.AddEvent(fakehost.DockerEvent{ContainerId: composeId, Action: "update", Time: time.Now()})
+	if _, err := GetContainerMetadata(runtimes); err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Requests("/containers/" + podId + "/json"); n != 1 {
+		t.Errorf("inspected %s %d times, want 1", podId, n)
+	}
+	if n := srv.Requests("/containers/" + composeId + "/json"); n != 2 {
+		t.Errorf("inspected %s %d times, want 2", composeId, n)
+	}
+	if n := srv.Requests("/images/sha256:i1/json"); n != 1 {
+		t.Errorf("inspected image %d times, want 1", n)
+	}
+}
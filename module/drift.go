@@ -0,0 +1,138 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Where the binary of a process comes from.
+const (
+	ExeOriginHost    = "host"
+	ExeOriginImage   = "image"
+	ExeOriginUpper   = "upper"
+	ExeOriginUnknown = "unknown"
+)
+
+// ExeInfo is the binary a process runs. Origin tells whether a container
+// process runs a binary of its image or one written to the container's
+// upper dir after it started, which is drift: the binary was not in the
+// image.
+type ExeInfo struct {
+	Path   string
+	Sha256 string
+	Origin string
+}
+
+// IsDrift reports whether the process runs a binary that was not in its
+// container's image.
+func (e ExeInfo) IsDrift() bool {
+	return e.Origin == ExeOriginUpper
+}
+
+// exeHashKey identifies the content of a binary without reading it. A
+// binary replaced in place changes its size or mtime.
+type exeHashKey struct {
+	dev   uint64
+	ino   uint64
+	size  int64
+	mtime int64
+}
+
+// exeHashCache is only touched by GetExeInfo, which runs from the singleton
+// Monitoring() job. Binaries no process runs anymore are dropped every run.
+var exeHashCache = map[exeHashKey]string{}
+
+// hashExe hashes the binary of a process through /proc/[pid]/exe, which
+// reaches it whatever mount namespace it lives in, even once deleted.
+func hashExe(pid int, hashes map[exeHashKey]string) (string, error) {
+	file, err := os.Open(procFS.Path(strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	var key exeHashKey
+	if stat, ok := fileInfo.Sys().(*syscall.Stat_t); ok {
+		key = exeHashKey{(uint64)(stat.Dev), stat.Ino, fileInfo.Size(), fileInfo.ModTime().UnixNano()}
+		if hash, ok := exeHashCache[key]; ok {
+			hashes[key] = hash
+			return hash, nil
+		}
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if key != (exeHashKey{}) {
+		hashes[key] = sum
+	}
+	return sum, nil
+}
+
+// exeOrigin looks the binary up in the container's upper dir. Overlayfs
+// copies a file up as soon as it is written to, so anything found there
+// was created or changed after the container started.
+func exeOrigin(exe string, diffDir string) string {
+	if diffDir == "" || exe == "" || strings.HasSuffix(exe, " (deleted)") {
+		return ExeOriginUnknown
+	}
+	if _, err := os.Lstat(filepath.Join(diffDir, exe)); err == nil {
+		return ExeOriginUpper
+	}
+	return ExeOriginImage
+}
+
+// getDiffDirs maps each of containerIds to its upper dir in diffList, as
+// returned by GetFileSystemDir.
+func getDiffDirs(containerIds []string, diffList []string) map[string]string {
+	diffDirs := make(map[string]string, len(containerIds))
+	for i, containerId := range containerIds {
+		if i < len(diffList) {
+			diffDirs[containerId] = diffList[i]
+		}
+	}
+	return diffDirs
+}
+
+// GetExeInfo hashes the binary of every process in procs and tells where
+// it comes from, in the same order. diffList holds the upper dir of each of
+// containerIds, as returned by GetFileSystemDir. Kernel threads and
+// processes whose binary can't be read have no hash.
+func GetExeInfo(procs []procfs.Proc, refMap map[int]ContainerRef, containerIds []string, diffList []string) ([]ExeInfo, error) {
+	exeInfoList := make([]ExeInfo, 0, len(procs))
+	hashes := make(map[exeHashKey]string)
+
+	diffDirs := getDiffDirs(containerIds, diffList)
+
+	for _, proc := range procs {
+		exeInfo := ExeInfo{Path: proc.Exe}
+		if proc.Exe == "" {
+			exeInfoList = append(exeInfoList, exeInfo)
+			continue
+		}
+		exeInfo.Sha256, _ = hashExe(proc.Pid, hashes)
+
+		if ref := refMap[proc.Pid]; ref.IsHost() {
+			exeInfo.Origin = ExeOriginHost
+		} else {
+			exeInfo.Origin = exeOrigin(proc.Exe, diffDirs[ref.ContainerId])
+		}
+		exeInfoList = append(exeInfoList, exeInfo)
+	}
+	exeHashCache = hashes
+
+	return exeInfoList, nil
+}
@@ -0,0 +1,58 @@
+package module
+
+import (
+	"reflect"
+	"testing"
+
+	"container-agent/fakehost"
+)
+
+func TestGetExeInfo(t *testing.T) {
+	h := newHost(t)
+
+	id := containerIdOf('a')
+	h.AddDockerContainer(id, "web", []string{"usr/local/bin/miner"})
+	h.WriteFile("usr/bin/tool", "hello\n")
+
+	h.AddProcess(fakehost.Process{Pid: 2, Comm: "kthreadd"})
+	h.AddProcess(fakehost.Process{Pid: 10, Cmdline: []string{"tool"}, Exe: h.Path("usr/bin/tool")})
+	h.AddProcess(fakehost.Process{Pid: 100, Cmdline: []string{"nginx"}, Exe: "/usr/sbin/nginx"})
+	h.AddProcess(fakehost.Process{Pid: 101, PPid: 100, Cmdline: []string{"miner"}, Exe: "/usr/local/bin/miner"})
+	h.AddProcess(fakehost.Process{Pid: 102, PPid: 100, Cmdline: []string{"sh"}, Exe: "/tmp/sh (deleted)"})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refMap := map[int]ContainerRef{2: hostRef, 10: hostRef, 100: podRef("web", id), 101: podRef("web", id), 102: podRef("web", id)}
+	diffList, err := GetFileSystemDir([]string{id}, refMap, map[string]string{id: RuntimeDocker}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exeList, err := GetExeInfo(procs, refMap, []string{id}, diffList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exeInfos := make(map[int]ExeInfo)
+	for i, proc := range procs {
+		exeInfos[proc.Pid] = exeList[i]
+	}
+	origins := map[int]string{}
+	for pid, exeInfo := range exeInfos {
+		origins[pid] = exeInfo.Origin
+	}
+	want := map[int]string{2: "", 10: ExeOriginHost, 100: ExeOriginImage, 101: ExeOriginUpper, 102: ExeOriginUnknown}
+	if !reflect.DeepEqual(origins, want) {
+		t.Errorf("got origins %v, want %v", origins, want)
+	}
+	if !exeInfos[101].IsDrift() || exeInfos[100].IsDrift() {
+		t.Errorf("unexpected drift %+v", exeInfos)
+	}
+	if exeInfos[10].Sha256 != "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" {
+		t.Errorf("got hash %q", exeInfos[10].Sha256)
+	}
+	if len(exeHashCache) != 1 {
+		t.Errorf("got %d cached hashes, want 1", len(exeHashCache))
+	}
+}
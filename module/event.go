@@ -0,0 +1,298 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Process event types. "exec" is only reported by the proc connector, the
+// /proc poll sees an exec as a change of name and command line.
+const (
+	EventStarted = "started"
+	EventExited  = "exited"
+	EventChanged = "changed"
+	EventExec    = "exec"
+)
+
+// Where an event was seen.
+const (
+	EventSourcePoll      = "poll"
+	EventSourceConnector = "connector"
+)
+
+const (
+	// maxEvents is the number of events kept, older ones are dropped.
+	maxEvents = 10000
+
+	DefaultEventLimit = 100
+	MaxEventLimit     = 1000
+)
+
+// ProcessEvent is a change between two Monitoring() runs. Id increases by
+// one with every event and is the cursor of the /events endpoint.
+// ProcessKey identifies the process, as pids get reused, and StartTime is
+// when it started, in RFC3339. Both are empty if the process was gone before
+// the connector could read it. Changes lists what changed for "changed" and
+// "exec" events, as "<field>: <old> -> <new>". Cwd is only captured by the
+// connector. Message details OOM kills and stuck processes.
+type ProcessEvent struct {
+	Id          uint64 `json:"Id"`
+	Time        string `json:"Time"`
+	Type        string `json:"Type"`
+	Source      string `json:"Source"`
+	ProcessId   string `json:"ProcessId"`
+	ProcessKey  string `json:"ProcessKey"`
+	StartTime   string `json:"StartTime"`
+	ProcessName string `json:"ProcessName"`
+	Cmdline     string `json:"Cmdline"`
+	Cwd         string `json:"Cwd,omitempty"`
+	Uid         string `json:"Uid"`
+	ParentId    string `json:"ParentId"`
+	ContainerRef
+	Changes []string `json:"Changes,omitempty"`
+	Message string   `json:"Message,omitempty"`
+}
+
+// EventPage is a page of events after a cursor. NextCursor is the Id of the
+// last event of the page, to be passed as since for the next one.
+type EventPage struct {
+	Events     []ProcessEvent `json:"Events"`
+	NextCursor uint64         `json:"NextCursor"`
+	HasMore    bool           `json:"HasMore"`
+}
+
+type processSnapshot struct {
+	comm    string
+	cmdline string
+	ppid    int
+	uid     uint32
+	ref     ContainerRef
+}
+
+// prevProcesses and processEvents are shared by GetProcessEvents, run by
+// Monitoring(), and the proc connector collector, so both hold eventsMutex.
+// prevProcesses is nil until the first run. prevPids and prevContainers
+// index it by pid and by container ID for the connector, which looks
+// processes up on every event; they only change along with it.
+var (
+	eventsMutex    sync.Mutex
+	prevProcesses  map[processKey]processSnapshot
+	prevPids       map[int]processKey
+	prevContainers map[string]ContainerRef
+	processEvents  []ProcessEvent
+	nextEventId    uint64 = 1
+	eventsLoaded   bool
+)
+
+// setPrevProcesses replaces prevProcesses and rebuilds its indexes. The
+// caller holds eventsMutex.
+func setPrevProcesses(processes map[processKey]processSnapshot) {
+	prevProcesses = processes
+	prevPids = make(map[int]processKey, len(processes))
+	prevContainers = make(map[string]ContainerRef)
+	for key, snapshot := range processes {
+		addPrevProcess(key, snapshot)
+	}
+}
+
+// addPrevProcess adds or replaces a process of prevProcesses. The caller
+// holds eventsMutex.
+func addPrevProcess(key processKey, snapshot processSnapshot) {
+	prevProcesses[key] = snapshot
+	prevPids[key.pid] = key
+	if !snapshot.ref.IsHost() {
+		prevContainers[snapshot.ref.ContainerId] = snapshot.ref
+	}
+}
+
+// removePrevProcess removes a process of prevProcesses. Its container stays
+// known until the next run, other processes may still run in it. The
+// caller holds eventsMutex.
+func removePrevProcess(key processKey) {
+	delete(prevProcesses, key)
+	if prevPids[key.pid] == key {
+		delete(prevPids, key.pid)
+	}
+}
+
+// loadProcessEvents picks up the events a previous instance of the agent
+// left in the output directory, so cursors stay valid across restarts. It
+// must run before the first event is added. The caller holds eventsMutex.
+func loadProcessEvents() {
+	if eventsLoaded {
+		return
+	}
+	eventsLoaded = true
+
+	data, err := ioutil.ReadFile(outputDir + "/events")
+	if err != nil {
+		return
+	}
+	var events []ProcessEvent
+	if err := json.Unmarshal(data, &events); err != nil {
+		return
+	}
+	processEvents = events
+	if len(events) > 0 {
+		nextEventId = events[len(events)-1].Id + 1
+	}
+}
+
+func newProcessSnapshot(proc procfs.Proc, ref ContainerRef) processSnapshot {
+	return processSnapshot{
+		comm:    proc.Stat.Comm,
+		cmdline: proc.CmdlineString(),
+		ppid:    proc.Stat.PPid,
+		uid:     proc.Status.Uids[1],
+		ref:     ref,
+	}
+}
+
+func newProcessEvent(eventType string, source string, key processKey, snapshot processSnapshot, now time.Time) ProcessEvent {
+	event := ProcessEvent{
+		Id:           nextEventId,
+		Time:         now.UTC().Format(time.RFC3339),
+		Type:         eventType,
+		Source:       source,
+		ProcessId:    strconv.Itoa(key.pid),
+		ProcessKey:   key.String(),
+		StartTime:    formatStartTime(key.startTime),
+		ProcessName:  snapshot.comm,
+		Cmdline:      snapshot.cmdline,
+		Uid:          strconv.FormatUint((uint64)(snapshot.uid), 10),
+		ParentId:     strconv.Itoa(snapshot.ppid),
+		ContainerRef: snapshot.ref,
+	}
+	nextEventId++
+	return event
+}
+
+func snapshotChanges(prev processSnapshot, now processSnapshot) []string {
+	var changes []string
+	if prev.comm != now.comm {
+		changes = append(changes, fmt.Sprintf("ProcessName: %s -> %s", prev.comm, now.comm))
+	}
+	if prev.cmdline != now.cmdline {
+		changes = append(changes, fmt.Sprintf("Cmdline: %s -> %s", prev.cmdline, now.cmdline))
+	}
+	if prev.ppid != now.ppid {
+		changes = append(changes, fmt.Sprintf("ParentId: %d -> %d", prev.ppid, now.ppid))
+	}
+	if prev.uid != now.uid {
+		changes = append(changes, fmt.Sprintf("Uid: %d -> %d", prev.uid, now.uid))
+	}
+	// Only the container counts: its pod fields come and go with the
+	// runtime socket answering or not.
+	if prev.ref.ContainerId != now.ref.ContainerId || prev.ref.Runtime != now.ref.Runtime {
+		changes = append(changes, fmt.Sprintf("WhoIsParent: %s -> %s", prev.ref, now.ref))
+	}
+	return changes
+}
+
+// GetProcessEvents compares procs with the processes of the previous run
+// and returns the retained events, oldest first. The first run only takes
+// the snapshot, as every process would show up as started otherwise.
+// Processes the connector already reported are part of the previous run.
+func GetProcessEvents(procs []procfs.Proc, refMap map[int]ContainerRef, now time.Time) (string, error) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	loadProcessEvents()
+
+	processes := make(map[processKey]processSnapshot, len(procs))
+	for _, proc := range procs {
+		processes[newProcessKey(proc)] = newProcessSnapshot(proc, refMap[proc.Pid])
+	}
+
+	if prevProcesses != nil {
+		var exited []processKey
+		for key := range prevProcesses {
+			if _, ok := processes[key]; !ok {
+				exited = append(exited, key)
+			}
+		}
+		sort.Slice(exited, func(i, j int) bool {
+			return exited[i].pid < exited[j].pid
+		})
+		for _, key := range exited {
+			processEvents = append(processEvents, newProcessEvent(EventExited, EventSourcePoll, key, prevProcesses[key], now))
+		}
+
+		for _, proc := range procs {
+			key := newProcessKey(proc)
+			snapshot := processes[key]
+			prev, ok := prevProcesses[key]
+			if !ok {
+				processEvents = append(processEvents, newProcessEvent(EventStarted, EventSourcePoll, key, snapshot, now))
+				continue
+			}
+			if changes := snapshotChanges(prev, snapshot); changes != nil {
+				event := newProcessEvent(EventChanged, EventSourcePoll, key, snapshot, now)
+				event.Changes = changes
+				processEvents = append(processEvents, event)
+			}
+		}
+	}
+	setPrevProcesses(processes)
+
+	return marshalProcessEvents()
+}
+
+// marshalProcessEvents drops the events beyond maxEvents and returns the
+// others. The caller holds eventsMutex.
+func marshalProcessEvents() (string, error) {
+	if len(processEvents) > maxEvents {
+		processEvents = append([]ProcessEvent(nil), processEvents[len(processEvents)-maxEvents:]...)
+	}
+
+	events := processEvents
+	if events == nil {
+		events = make([]ProcessEvent, 0)
+	}
+	jsonData, err := json.MarshalIndent(events, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
+
+// FilterEvents returns the page of at most limit events after the since
+// cursor.
+func FilterEvents(eventsJson []byte, since uint64, limit int) (string, error) {
+	var events []ProcessEvent
+
+	err := json.Unmarshal(eventsJson, &events)
+	if err != nil {
+		return "", err
+	}
+
+	first := sort.Search(len(events), func(i int) bool {
+		return events[i].Id > since
+	})
+	page := EventPage{
+		Events:     make([]ProcessEvent, 0),
+		NextCursor: since,
+	}
+	for _, event := range events[first:] {
+		if len(page.Events) == limit {
+			page.HasMore = true
+			break
+		}
+		page.Events = append(page.Events, event)
+		page.NextCursor = event.Id
+	}
+
+	jsonData, err := json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
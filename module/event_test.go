@@ -0,0 +1,61 @@
+package module
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"container-agent/procfs"
+)
+
+func TestGetProcessEvents(t *testing.T) {
+	newHost(t)
+	prevProcesses, prevPids, prevContainers, processEvents, nextEventId = nil, nil, nil, nil, 1
+	t.Cleanup(func() { prevProcesses, prevPids, prevContainers, processEvents, nextEventId = nil, nil, nil, nil, 1 })
+
+	proc := func(pid int, startTime uint64, comm string) procfs.Proc {
+		return procfs.Proc{Pid: pid, Stat: procfs.ProcStat{Comm: comm, PPid: 1, StartTime: startTime}}
+	}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	refMap := map[int]ContainerRef{10: hostRef, 20: podRef("web", containerIdOf('a')), 30: hostRef}
+
+	if _, err := GetProcessEvents([]procfs.Proc{proc(10, 100, "sh"), proc(20, 200, "nginx")}, refMap, now); err != nil {
+		t.Fatal(err)
+	}
+	// pid 10 was reused, 20 exec'd, 30 is new. The namespace of 20 is only
+	// known now, which is no change of container.
+	refMap[20] = ContainerRef{PodName: "web", PodNamespace: "shop", ContainerId: containerIdOf('a')}
+	eventsJson, err := GetProcessEvents([]procfs.Proc{proc(10, 500, "sh"), proc(20, 200, "nginx-worker"), proc(30, 600, "cat")}, refMap, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []ProcessEvent
+	if err := json.Unmarshal([]byte(eventsJson), &events); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Type+" "+event.ProcessId+" "+event.PodName)
+	}
+	want := []string{"exited 10 Host", "started 10 Host", "changed 20 web", "started 30 Host"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(events[2].Changes, []string{"ProcessName: nginx -> nginx-worker"}) || events[3].Id != 4 {
+		t.Errorf("unexpected event %+v", events[2])
+	}
+
+	page, err := FilterEvents([]byte(eventsJson), 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var eventPage EventPage
+	if err := json.Unmarshal([]byte(page), &eventPage); err != nil {
+		t.Fatal(err)
+	}
+	if len(eventPage.Events) != 2 || eventPage.Events[0].Id != 2 || eventPage.NextCursor != 3 || !eventPage.HasMore {
+		t.Errorf("unexpected page %+v", eventPage)
+	}
+}
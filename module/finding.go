@@ -0,0 +1,159 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Finding types.
+const (
+	FindingDeletedExe     = "deleted-exe"
+	FindingMemfdExe       = "memfd-exe"
+	FindingShmExe         = "shm-exe"
+	FindingAnonExecMemory = "anonymous-exec-mapping"
+)
+
+// Finding severities.
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+)
+
+// Finding is something suspicious about a process, attributed to its
+// container like the rest of the process info.
+type Finding struct {
+	Type        string `json:"Type"`
+	Severity    string `json:"Severity"`
+	ProcessId   string `json:"ProcessId"`
+	ProcessName string `json:"ProcessName"`
+	Cmdline     string `json:"Cmdline"`
+	Exe         string `json:"Exe"`
+	ContainerRef
+	Detail string `json:"Detail"`
+}
+
+func newFinding(findingType string, severity string, proc procfs.Proc, ref ContainerRef, detail string) Finding {
+	return Finding{
+		Type:         findingType,
+		Severity:     severity,
+		ProcessId:    strconv.Itoa(proc.Pid),
+		ProcessName:  proc.Stat.Comm,
+		Cmdline:      proc.CmdlineString(),
+		Exe:          proc.Exe,
+		ContainerRef: ref,
+		Detail:       detail,
+	}
+}
+
+// exeFinding tells whether the binary of a process is gone from the
+// filesystem: deleted after it was started, or never there, run from a
+// memfd or from tmpfs in /dev/shm. The kernel marks the first two with a
+// " (deleted)" suffix, memfds are always shown as deleted.
+func exeFinding(exe string) (string, bool) {
+	switch {
+	case strings.HasPrefix(exe, "/memfd:"):
+		return FindingMemfdExe, true
+	case strings.HasPrefix(exe, "/dev/shm/"):
+		return FindingShmExe, true
+	case strings.HasSuffix(exe, " (deleted)"):
+		return FindingDeletedExe, true
+	}
+	return "", false
+}
+
+// anonExecMappings returns the anonymous executable mappings of a process,
+// leaving out the kernel's own ([vdso], [vsyscall]...).
+func anonExecMappings(mappings []procfs.Mapping) []procfs.Mapping {
+	var anonExec []procfs.Mapping
+	for _, mapping := range mappings {
+		if mapping.IsExecutable() && mapping.Inode == 0 && (mapping.Path == "" || mapping.Path == "[heap]" || mapping.Path == "[stack]") {
+			anonExec = append(anonExec, mapping)
+		}
+	}
+	return anonExec
+}
+
+// GetMappings reads the memory mappings of every process of procs with an
+// exe, once per Monitoring() run for every detector looking at them.
+// Processes whose maps can't be read are left out.
+func GetMappings(procs []procfs.Proc) map[int][]procfs.Mapping {
+	mappingMap := make(map[int][]procfs.Mapping, len(procs))
+	for _, proc := range procs {
+		if proc.Exe == "" {
+			continue
+		}
+		if mappings, err := procFS.Maps(proc.Pid); err == nil {
+			mappingMap[proc.Pid] = mappings
+		}
+	}
+	return mappingMap
+}
+
+// GetFilelessFindings flags processes running a binary that is not on disk and
+// processes executing anonymous memory, the usual ways to run code without
+// leaving a file behind. JIT compilers (java, node...) map anonymous
+// executable memory too, so those are worth a look rather than proof.
+func GetFilelessFindings(procs []procfs.Proc, mappingMap map[int][]procfs.Mapping, refMap map[int]ContainerRef) ([]Finding, error) {
+	findings := make([]Finding, 0)
+
+	for _, proc := range procs {
+		if proc.Exe == "" {
+			// Kernel thread, or not readable.
+			continue
+		}
+		ref := refMap[proc.Pid]
+
+		if findingType, ok := exeFinding(proc.Exe); ok {
+			findings = append(findings, newFinding(findingType, SeverityHigh, proc, ref, "exe: "+proc.Exe))
+		}
+
+		anonExec := anonExecMappings(mappingMap[proc.Pid])
+		if len(anonExec) == 0 {
+			continue
+		}
+		var size uint64
+		var writable int
+		for _, mapping := range anonExec {
+			size += mapping.End - mapping.Start
+			if mapping.IsWritable() {
+				writable++
+			}
+		}
+		detail := fmt.Sprintf("%d anonymous executable mappings (%d writable), %s, first at %x %s",
+			len(anonExec), writable, formatMB(size), anonExec[0].Start, anonExec[0].Perms)
+		findings = append(findings, newFinding(FindingAnonExecMemory, SeverityHigh, proc, ref, detail))
+	}
+
+	return findings, nil
+}
+
+// GetFindings collects the findings of every detector. mappingMap and
+// injectionList are the output of GetMappings and GetInjectionInfo. Like
+// the process trees, the host comes first and the containers follow by pod
+// name.
+func GetFindings(procs []procfs.Proc, mappingMap map[int][]procfs.Mapping, refMap map[int]ContainerRef, injectionList []Injection) (string, error) {
+	findings, err := GetFilelessFindings(procs, mappingMap, refMap)
+	if err != nil {
+		return "", err
+	}
+	findings = append(findings, GetInjectionFindings(procs, refMap, injectionList)...)
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.IsHost() != b.IsHost() {
+			return a.IsHost()
+		}
+		return a.PodName < b.PodName
+	})
+
+	jsonData, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
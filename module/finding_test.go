@@ -0,0 +1,121 @@
+package module
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"container-agent/fakehost"
+)
+
+func TestGetFindings(t *testing.T) {
+	h := newHost(t)
+
+	id := containerIdOf('a')
+	h.AddProcess(fakehost.Process{Pid: 2, Comm: "kthreadd"})
+	h.AddProcess(fakehost.Process{Pid: 10, Cmdline: []string{"sshd"}, Exe: "/usr/sbin/sshd"})
+	h.AddProcess(fakehost.Process{Pid: 11, Cmdline: []string{"updater"}, Exe: "/tmp/updater (deleted)"})
+	h.AddProcess(fakehost.Process{Pid: 100, Cmdline: []string{"nginx"}, Exe: "/usr/sbin/nginx"})
+	h.AddProcess(fakehost.Process{Pid: 101, PPid: 100, Cmdline: []string{"x"}, Exe: "/memfd:x (deleted)"})
+	h.AddProcess(fakehost.Process{Pid: 102, PPid: 100, Cmdline: []string{"y"}, Exe: "/dev/shm/y"})
+	h.WriteFile("proc/10/maps", "55d0c1a00000-55d0c1a02000 r-xp 00002000 fd:01 681885                     /usr/sbin/sshd\n7ffd5b3f2000-7ffd5b3f4000 r-xp 00000000 00:00 0                          [vdso]\n")
+	h.WriteFile("proc/100/maps", "55d0c1a00000-55d0c1a02000 r-xp 00002000 fd:01 681885                     /usr/sbin/nginx\n7f2a40000000-7f2a40100000 rwxp 00000000 00:00 0 \n7f2a40200000-7f2a40300000 r-xp 00000000 00:00 0 \n")
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refMap := map[int]ContainerRef{2: hostRef, 10: hostRef, 11: hostRef, 100: podRef("web", id), 101: podRef("web", id), 102: podRef("web", id)}
+
+	findingsJson, err := GetFindings(procs, GetMappings(procs), refMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var findings []Finding
+	if err := json.Unmarshal([]byte(findingsJson), &findings); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for _, finding := range findings {
+		if finding.Severity != SeverityHigh {
+			t.Errorf("got severity %q for %+v", finding.Severity, finding)
+		}
+		got[finding.ProcessId] = finding.Type
+	}
+	want := map[string]string{"11": FindingDeletedExe, "100": FindingAnonExecMemory, "101": FindingMemfdExe, "102": FindingShmExe}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got findings %v, want %v", got, want)
+	}
+	if findings[0].ContainerId != "" || findings[len(findings)-1].ContainerId != id || findings[len(findings)-1].PodName != "web" {
+		t.Errorf("wrong order or attribution %+v", findings)
+	}
+	for _, finding := range findings {
+		if finding.ProcessId == "100" && finding.Detail != "2 anonymous executable mappings (1 writable), 2.0MB, first at 7f2a40000000 rwxp" {
+			t.Errorf("got detail %q", finding.Detail)
+		}
+	}
+}
+
+func TestGetInjectionFindings(t *testing.T) {
+	h := newHost(t)
+
+	id := containerIdOf('a')
+	h.AddDockerContainer(id, "web", []string{"app/libhook.so"})
+	h.WriteFile("etc/ld.so.preload", "# nothing here\n")
+
+	h.AddProcess(fakehost.Process{Pid: 10, Cmdline: []string{"sshd"}, Exe: "/usr/sbin/sshd", Environ: []string{"LD_PRELOAD=/tmp/.x/libx.so", "HOME=/root"}})
+	h.AddProcess(fakehost.Process{Pid: 11, Cmdline: []string{"cron"}, Exe: "/usr/sbin/cron"})
+	h.AddProcess(fakehost.Process{Pid: 100, Cmdline: []string{"app"}, Exe: "/app/server", Environ: []string{"LD_LIBRARY_PATH=/app/lib"}})
+	h.WriteFile("proc/11/maps", "55d0c1a00000-55d0c1a02000 r-xp 00002000 fd:01 681885                     /usr/sbin/cron\n7f2a40000000-7f2a40100000 r-xp 00000000 00:15 12                         /dev/shm/libz.so (deleted)\n7f2a40200000-7f2a40300000 r-xp 00000000 fd:01 13                         /usr/lib/libc.so.6\n")
+	h.WriteFile("proc/100/maps", "55d0c1a00000-55d0c1a02000 r-xp 00002000 00:2a 681885                     /app/server\n7f2a40000000-7f2a40100000 r-xp 00000000 00:2a 12                         /app/libhook.so\n7f2a40100000-7f2a40200000 r--p 00000000 00:2a 12                         /app/libhook.so\n")
+	h.WriteFile("proc/100/root/etc/ld.so.preload", "/app/libhook.so\n")
+
+	procs, err := readAllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(procs[0].Environ, []string{"LD_PRELOAD=/tmp/.x/libx.so"}) {
+		t.Errorf("got environ %q, want only the loader variables", procs[0].Environ)
+	}
+	refMap := map[int]ContainerRef{10: hostRef, 11: hostRef, 100: podRef("web", id)}
+	diffList, err := GetFileSystemDir([]string{id}, refMap, map[string]string{id: RuntimeDocker}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	injectionList, err := GetInjectionInfo(procs, GetMappings(procs), refMap, []string{id}, diffList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	injections := make(map[int]Injection)
+	for i, proc := range procs {
+		injections[proc.Pid] = injectionList[i]
+	}
+	want := map[int]Injection{
+		10:  {LdPreload: "/tmp/.x/libx.so"},
+		11:  {WritableLibraries: []string{"/dev/shm/libz.so (deleted)"}},
+		100: {LdLibraryPath: "/app/lib", WritableLibraries: []string{"/app/libhook.so"}},
+	}
+	if !reflect.DeepEqual(injections, want) {
+		t.Errorf("got %+v, want %+v", injections, want)
+	}
+
+	var got []string
+	for _, finding := range GetInjectionFindings(procs, refMap, injectionList) {
+		got = append(got, finding.Type+" "+finding.ProcessId+" "+finding.ContainerId+" "+finding.Detail)
+	}
+	wantFindings := []string{
+		FindingLdPreloadEnv + " 10  LD_PRELOAD=/tmp/.x/libx.so",
+		FindingWritableLibrary + " 11  library: /dev/shm/libz.so (deleted)",
+		FindingLdSoPreload + "  " + id + " /etc/ld.so.preload: /app/libhook.so",
+		FindingLdLibraryPathEnv + " 100 " + id + " LD_LIBRARY_PATH=/app/lib",
+		FindingWritableLibrary + " 100 " + id + " library: /app/libhook.so",
+	}
+	sort.Strings(got)
+	sort.Strings(wantFindings)
+	if !reflect.DeepEqual(got, wantFindings) {
+		t.Errorf("got findings\n%v\nwant\n%v", got, wantFindings)
+	}
+}
@@ -0,0 +1,91 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// processKey identifies a process across Monitoring() runs. A pid alone
+// merges two processes when the pid is reused between runs, but a pid
+// can't be reused within the clock tick its previous owner started in.
+// startTime is 0 when the process was gone before it could be read.
+type processKey struct {
+	pid       int
+	startTime uint64
+}
+
+func newProcessKey(proc procfs.Proc) processKey {
+	return processKey{proc.Pid, proc.Stat.StartTime}
+}
+
+// String returns the key as "<pid>-<starttime>", or "" if the start time
+// is unknown.
+func (k processKey) String() string {
+	if k.startTime == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", k.pid, k.startTime)
+}
+
+// bootTime caches btime from /proc/stat, the boot time of the host in
+// seconds since the epoch, which can't change until the next boot. It is
+// 0 until read, and reset by Configure.
+var bootTime uint64
+
+// cachedClockTicks caches CLK_TCK for GetClockTicks, which is called for every
+// process and event. Unlike bootTime it is the agent's own and is kept
+// across Configure.
+var (
+	clockTicksOnce   sync.Once
+	cachedClockTicks float64
+)
+
+// GetBootTime returns the time the host booted.
+func GetBootTime() (time.Time, error) {
+	if bootTime == 0 {
+		kernelStat, err := procFS.KernelStat()
+		if err != nil {
+			return time.Time{}, err
+		}
+		bootTime = kernelStat.BootTime
+	}
+	return time.Unix((int64)(bootTime), 0), nil
+}
+
+// processStartTime converts the start time of a process, in clock ticks
+// after boot, to wall clock time. It returns the zero time if btime can't
+// be read.
+func processStartTime(startTime uint64) time.Time {
+	boot, err := GetBootTime()
+	if err != nil {
+		return time.Time{}
+	}
+	ticks := (int64)(startTime)
+	clockTicks := (int64)(GetClockTicks())
+	return boot.Add(time.Duration(ticks/clockTicks)*time.Second + time.Duration(ticks%clockTicks)*time.Second/time.Duration(clockTicks))
+}
+
+// formatStartTime formats the start time of a process as RFC3339, or ""
+// if it is unknown.
+func formatStartTime(startTime uint64) string {
+	if startTime == 0 {
+		return ""
+	}
+	start := processStartTime(startTime)
+	if start.IsZero() {
+		return ""
+	}
+	return start.UTC().Format(time.RFC3339)
+}
+
+// formatAge returns how long a process has been running at now, to the
+// second.
+func formatAge(startTime uint64, now time.Time) string {
+	start := processStartTime(startTime)
+	if start.IsZero() || now.Before(start) {
+		return ""
+	}
+	return now.Sub(start).Truncate(time.Second).String()
+}
@@ -0,0 +1,31 @@
+package module
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"container-agent/procfs"
+)
+
+func TestProcessIdentity(t *testing.T) {
+	newHost(t)
+
+	clockTicks := (uint64)(GetClockTicks())
+	proc := procfs.Proc{Pid: 42, Stat: procfs.ProcStat{StartTime: 2*clockTicks + clockTicks/2}}
+	if key := newProcessKey(proc).String(); key != fmt.Sprintf("42-%d", proc.Stat.StartTime) {
+		t.Errorf("got key %q", key)
+	}
+	if key := (processKey{pid: 42}).String(); key != "" {
+		t.Errorf("got key %q for an unknown start time", key)
+	}
+
+	// fakehost boots at 1600000000, 2020-09-13T12:26:40Z.
+	if startTime := formatStartTime(proc.Stat.StartTime); startTime != "2020-09-13T12:26:42Z" {
+		t.Errorf("got start time %q", startTime)
+	}
+	now := time.Unix(1600000000, 0).Add(time.Hour + 3*time.Second)
+	if age := formatAge(proc.Stat.StartTime, now); age != "1h0m0s" {
+		t.Errorf("got age %q", age)
+	}
+}
@@ -0,0 +1,164 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Library injection finding types.
+const (
+	FindingLdPreloadEnv     = "ld-preload-env"
+	FindingLdLibraryPathEnv = "ld-library-path-env"
+	FindingWritableLibrary  = "writable-library"
+	FindingLdSoPreload      = "ld-so-preload"
+)
+
+// writableDirs are world writable directories nothing should load code
+// from.
+var writableDirs = []string{"/tmp/", "/var/tmp/", "/dev/shm/"}
+
+// Injection is what the dynamic loader was told to load into a process
+// besides its own dependencies, and the libraries it mapped from writable
+// locations: the world writable directories or its container's upper dir.
+type Injection struct {
+	LdPreload         string   `json:"LdPreload,omitempty"`
+	LdLibraryPath     string   `json:"LdLibraryPath,omitempty"`
+	WritableLibraries []string `json:"WritableLibraries,omitempty"`
+}
+
+// IsEmpty reports whether nothing was found.
+func (i Injection) IsEmpty() bool {
+	return i.LdPreload == "" && i.LdLibraryPath == "" && len(i.WritableLibraries) == 0
+}
+
+// isWritableLibrary tells whether a mapped file lives in one of the
+// writable directories or was written to the container's upper dir.
+func isWritableLibrary(path string, diffDir string) bool {
+	path = strings.TrimSuffix(path, " (deleted)")
+	for _, dir := range writableDirs {
+		if strings.HasPrefix(path, dir) {
+			return true
+		}
+	}
+	return diffDir != "" && exeOrigin(path, diffDir) == ExeOriginUpper
+}
+
+// writableLibraries returns the files other than exe a process maps
+// executable from writable locations.
+func writableLibraries(mappings []procfs.Mapping, exe string, diffDir string) []string {
+	var libraries []string
+	seen := make(map[string]bool)
+	for _, mapping := range mappings {
+		if !mapping.IsExecutable() || mapping.Inode == 0 || mapping.Path == exe || seen[mapping.Path] {
+			continue
+		}
+		seen[mapping.Path] = true
+		if isWritableLibrary(mapping.Path, diffDir) {
+			libraries = append(libraries, mapping.Path)
+		}
+	}
+	return libraries
+}
+
+// GetInjectionInfo looks for library injection in every process of procs,
+// in the same order. It looks at the loader variables readAllProcs keeps
+// whether or not the environment is captured, and at the mappings of
+// mappingMap, as returned by GetMappings. diffList holds the upper dir of
+// each of containerIds, as returned by GetFileSystemDir.
+func GetInjectionInfo(procs []procfs.Proc, mappingMap map[int][]procfs.Mapping, refMap map[int]ContainerRef, containerIds []string, diffList []string) ([]Injection, error) {
+	injectionList := make([]Injection, 0, len(procs))
+	diffDirs := getDiffDirs(containerIds, diffList)
+
+	for _, proc := range procs {
+		var injection Injection
+		if proc.Exe == "" {
+			injectionList = append(injectionList, injection)
+			continue
+		}
+
+		for _, variable := range proc.Environ {
+			name, value, _ := strings.Cut(variable, "=")
+			switch name {
+			case "LD_PRELOAD":
+				injection.LdPreload = value
+			case "LD_LIBRARY_PATH":
+				injection.LdLibraryPath = value
+			}
+		}
+
+		injection.WritableLibraries = writableLibraries(mappingMap[proc.Pid], proc.Exe, diffDirs[refMap[proc.Pid].ContainerId])
+		injectionList = append(injectionList, injection)
+	}
+
+	return injectionList, nil
+}
+
+// readLdSoPreload returns the libraries listed in an /etc/ld.so.preload,
+// which the loader injects into every dynamically linked process.
+func readLdSoPreload(filePath string) []string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil
+	}
+	var libraries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		libraries = append(libraries, strings.Fields(line)...)
+	}
+	return libraries
+}
+
+// GetInjectionFindings turns injectionList, as returned by
+// GetInjectionInfo, into findings, and adds one for the host and every
+// container with a non empty /etc/ld.so.preload. A container's file is read
+// through the root of its first process, which sees the merged image.
+func GetInjectionFindings(procs []procfs.Proc, refMap map[int]ContainerRef, injectionList []Injection) []Finding {
+	findings := make([]Finding, 0)
+
+	if libraries := readLdSoPreload(filepath.Join(hostRoot, "etc", "ld.so.preload")); len(libraries) > 0 {
+		findings = append(findings, Finding{
+			Type:         FindingLdSoPreload,
+			Severity:     SeverityHigh,
+			ContainerRef: hostRef,
+			Detail:       "/etc/ld.so.preload: " + strings.Join(libraries, ", "),
+		})
+	}
+
+	checked := make(map[string]bool)
+	for i, proc := range procs {
+		ref := refMap[proc.Pid]
+		if !ref.IsHost() && proc.Exe != "" && !checked[ref.ContainerId] {
+			checked[ref.ContainerId] = true
+			ldSoPreload := procFS.Path(strconv.Itoa(proc.Pid), "root", "etc", "ld.so.preload")
+			if libraries := readLdSoPreload(ldSoPreload); len(libraries) > 0 {
+				findings = append(findings, Finding{
+					Type:         FindingLdSoPreload,
+					Severity:     SeverityHigh,
+					ContainerRef: ref,
+					Detail:       "/etc/ld.so.preload: " + strings.Join(libraries, ", "),
+				})
+			}
+		}
+
+		if i >= len(injectionList) {
+			continue
+		}
+		injection := injectionList[i]
+		if injection.LdPreload != "" {
+			findings = append(findings, newFinding(FindingLdPreloadEnv, SeverityHigh, proc, ref, "LD_PRELOAD="+injection.LdPreload))
+		}
+		if injection.LdLibraryPath != "" {
+			findings = append(findings, newFinding(FindingLdLibraryPathEnv, SeverityMedium, proc, ref, "LD_LIBRARY_PATH="+injection.LdLibraryPath))
+		}
+		for _, library := range injection.WritableLibraries {
+			findings = append(findings, newFinding(FindingWritableLibrary, SeverityHigh, proc, ref, "library: "+library))
+		}
+	}
+
+	return findings
+}
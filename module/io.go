@@ -0,0 +1,118 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"fmt"
+)
+
+// IoUsage is the I/O rate of a process over the last collection interval,
+// per second. ReadBytes and WriteBytes are what reached the storage layer,
+// ReadChars and WriteChars everything passed through read(2) and write(2),
+// pipes and sockets included.
+//
+// The kernel adds the counters of a reaped child to its parent, so a parent
+// may show a burst of I/O its children have already been reported for.
+type IoUsage struct {
+	ReadBytes     float64
+	WriteBytes    float64
+	ReadChars     float64
+	WriteChars    float64
+	ReadSyscalls  float64
+	WriteSyscalls float64
+}
+
+// ioSample is the I/O counters of a process as seen by the previous
+// Monitoring() run, see cpuSample.
+type ioSample struct {
+	io     procfs.ProcIO
+	uptime float64
+}
+
+// prevIoSamples is only touched by GetIoUsage, which runs from the
+// singleton Monitoring() job.
+var prevIoSamples = map[processKey]ioSample{}
+
+// counterRate returns the rate of a counter that went from prev to now over
+// seconds, or 0 if the counter went backwards.
+func counterRate(now uint64, prev uint64, seconds float64) float64 {
+	if seconds <= 0 || now < prev {
+		return 0
+	}
+	return (float64)(now-prev) / seconds
+}
+
+// GetIoUsage returns the I/O usage of every process in procs, in the same
+// order. Like GetCpuUsage it measures the interval since the previous run,
+// or the lifetime of processes it hasn't seen before. Processes whose io
+// file couldn't be read report 0.
+func GetIoUsage(procs []procfs.Proc, uptime float64) ([]IoUsage, error) {
+	ioUsageList := make([]IoUsage, 0, len(procs))
+
+	clockTicks := GetClockTicks()
+	ioSamples := make(map[processKey]ioSample, len(procs))
+
+	for _, proc := range procs {
+		starttime := proc.Stat.StartTime
+		key := newProcessKey(proc)
+		ioSamples[key] = ioSample{proc.IO, uptime}
+
+		var prevIo procfs.ProcIO
+		var seconds float64
+		if prev, ok := prevIoSamples[key]; ok && uptime > prev.uptime {
+			prevIo = prev.io
+			seconds = uptime - prev.uptime
+		} else {
+			seconds = uptime - (float64)(starttime)/clockTicks
+		}
+
+		ioUsageList = append(ioUsageList, IoUsage{
+			ReadBytes:     counterRate(proc.IO.ReadBytes, prevIo.ReadBytes, seconds),
+			WriteBytes:    counterRate(proc.IO.WriteBytes, prevIo.WriteBytes, seconds),
+			ReadChars:     counterRate(proc.IO.RChar, prevIo.RChar, seconds),
+			WriteChars:    counterRate(proc.IO.WChar, prevIo.WChar, seconds),
+			ReadSyscalls:  counterRate(proc.IO.SyscR, prevIo.SyscR, seconds),
+			WriteSyscalls: counterRate(proc.IO.SyscW, prevIo.SyscW, seconds),
+		})
+	}
+	prevIoSamples = ioSamples
+
+	return ioUsageList, nil
+}
+
+func (u *IoUsage) add(other IoUsage) {
+	u.ReadBytes += other.ReadBytes
+	u.WriteBytes += other.WriteBytes
+	u.ReadChars += other.ReadChars
+	u.WriteChars += other.WriteChars
+	u.ReadSyscalls += other.ReadSyscalls
+	u.WriteSyscalls += other.WriteSyscalls
+}
+
+func formatByteRate(bytesPerSecond float64) string {
+	return fmt.Sprintf("%.1fKB/s", bytesPerSecond/1024)
+}
+
+func formatRate(perSecond float64) string {
+	return fmt.Sprintf("%.1f/s", perSecond)
+}
+
+// IoRates is IoUsage formatted for the JSON output.
+type IoRates struct {
+	DiskRead      string `json:"DiskRead"`
+	DiskWrite     string `json:"DiskWrite"`
+	Read          string `json:"Read"`
+	Write         string `json:"Write"`
+	ReadSyscalls  string `json:"ReadSyscalls"`
+	WriteSyscalls string `json:"WriteSyscalls"`
+}
+
+func newIoRates(ioUsage IoUsage) IoRates {
+	return IoRates{
+		DiskRead:      formatByteRate(ioUsage.ReadBytes),
+		DiskWrite:     formatByteRate(ioUsage.WriteBytes),
+		Read:          formatByteRate(ioUsage.ReadChars),
+		Write:         formatByteRate(ioUsage.WriteChars),
+		ReadSyscalls:  formatRate(ioUsage.ReadSyscalls),
+		WriteSyscalls: formatRate(ioUsage.WriteSyscalls),
+	}
+}
@@ -0,0 +1,174 @@
+package module
+
+import (
+	"container-agent/kube"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kubeRelistDelay is how long the watcher waits before listing the pods
+// again after a watch ended.
+const kubeRelistDelay = 5 * time.Second
+
+// KubernetesInfo is what the API server tells about the pod of a container:
+// the workload managing it, found by following owner references, and the
+// container's requests and limits. WorkloadKind is empty for bare pods.
+type KubernetesInfo struct {
+	WorkloadKind   string            `json:"WorkloadKind"`
+	WorkloadName   string            `json:"WorkloadName"`
+	ServiceAccount string            `json:"ServiceAccount"`
+	Labels         map[string]string `json:"Labels,omitempty"`
+	Requests       map[string]string `json:"Requests,omitempty"`
+	Limits         map[string]string `json:"Limits,omitempty"`
+}
+
+// kubePod is a pod of the node and the workload managing it.
+type kubePod struct {
+	pod      kube.Pod
+	workload kube.OwnerReference
+}
+
+// workloadName returns "<kind> <namespace>/<name>", e.g.
+// "deployment payments/api", or "" for bare pods.
+func (p kubePod) workloadName() string {
+	if p.workload.Kind == "" {
+		return ""
+	}
+	return strings.ToLower(p.workload.Kind) + " " + p.pod.Metadata.Namespace + "/" + p.workload.Name
+}
+
+// kubePods are the pods of the node by UID, kept by RunKubeWatcher and
+// read by Monitoring(). It is nil unless the watcher runs.
+var (
+	kubePodsMutex sync.Mutex
+	kubePods      map[string]kubePod
+)
+
+// resolveWorkload follows the controller of a pod up to the workload a
+// user manages: ReplicaSets up to their Deployment, Jobs up to their
+// CronJob. owners caches the controllers of ReplicaSets and Jobs by UID,
+// the zero OwnerReference for those without one.
+func resolveWorkload(client *kube.Client, pod kube.Pod, owners map[string]kube.OwnerReference) kube.OwnerReference {
+	ref, ok := pod.Metadata.ControllerRef()
+	if !ok {
+		return kube.OwnerReference{}
+	}
+	if ref.Kind != "ReplicaSet" && ref.Kind != "Job" {
+		return ref
+	}
+
+	parent, ok := owners[ref.Uid]
+	if !ok {
+		object, err := client.GetOwner(pod.Metadata.Namespace, ref)
+		if err != nil {
+			// Asked again next time.
+			return ref
+		}
+		parent, _ = object.ControllerRef()
+		owners[ref.Uid] = parent
+	}
+	if parent.Kind == "" {
+		return ref
+	}
+	return parent
+}
+
+// RunKubeWatcher lists and watches the pods of nodeName and keeps their
+// workloads for Monitoring() to attribute containers to, until ctx is done.
+// A failing first list is returned, as it is likely for good (no RBAC, no
+// such node); later failures are retried.
+func RunKubeWatcher(ctx context.Context, client *kube.Client, nodeName string) error {
+	first := true
+	for {
+		pods, err := client.ListPods(nodeName)
+		if err != nil && first {
+			return err
+		}
+		first = false
+
+		if err == nil {
+			// Owners are only cached for a watch, so deleted ReplicaSets
+			// and Jobs don't pile up.
+			owners := make(map[string]kube.OwnerReference)
+			byUid := make(map[string]kubePod, len(pods.Items))
+			for _, pod := range pods.Items {
+				byUid[pod.Metadata.Uid] = kubePod{pod, resolveWorkload(client, pod, owners)}
+			}
+			kubePodsMutex.Lock()
+			kubePods = byUid
+			kubePodsMutex.Unlock()
+
+			err = client.WatchPods(ctx, nodeName, pods.Metadata.ResourceVersion, func(event kube.WatchEvent) {
+				var workload kube.OwnerReference
+				if event.Type == kube.EventAdded || event.Type == kube.EventModified {
+					workload = resolveWorkload(client, event.Object, owners)
+				}
+
+				kubePodsMutex.Lock()
+				defer kubePodsMutex.Unlock()
+				switch event.Type {
+				case kube.EventAdded, kube.EventModified:
+					kubePods[event.Object.Metadata.Uid] = kubePod{event.Object, workload}
+				case kube.EventDeleted:
+					delete(kubePods, event.Object.Metadata.Uid)
+				}
+			})
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Println("kubernetes:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(kubeRelistDelay):
+		}
+	}
+}
+
+// getKubePod returns the pod with podUid, or else the one named podName in
+// podNamespace, as last seen by the watcher.
+func getKubePod(podUid string, podNamespace string, podName string) (kubePod, bool) {
+	kubePodsMutex.Lock()
+	defer kubePodsMutex.Unlock()
+
+	if pod, ok := kubePods[podUid]; ok && podUid != "" {
+		return pod, true
+	}
+	if podName == "" {
+		return kubePod{}, false
+	}
+	for _, pod := range kubePods {
+		if pod.pod.Metadata.Name == podName && pod.pod.Metadata.Namespace == podNamespace {
+			return pod, true
+		}
+	}
+	return kubePod{}, false
+}
+
+// getKubernetesInfo returns what the API server tells about the pod of
+// ref, or nil if the watcher doesn't know it.
+func getKubernetesInfo(ref ContainerRef) *KubernetesInfo {
+	pod, ok := getKubePod(ref.PodUid, ref.PodNamespace, ref.PodName)
+	if !ok {
+		return nil
+	}
+
+	info := &KubernetesInfo{
+		WorkloadKind:   pod.workload.Kind,
+		WorkloadName:   pod.workload.Name,
+		ServiceAccount: pod.pod.Spec.ServiceAccountName,
+		Labels:         pod.pod.Metadata.Labels,
+	}
+	if container, ok := pod.pod.Container(ref.ContainerName); ok {
+		info.Requests = container.Resources.Requests
+		info.Limits = container.Resources.Limits
+	}
+	return info
+}
@@ -0,0 +1,117 @@
+package module
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"container-agent/fakehost"
+	"container-agent/kube"
+)
+
+func TestRunKubeWatcher(t *testing.T) {
+	h := newHost(t)
+
+	srv := &fakehost.KubeServer{
+		Token: "secret",
+		// What the ClusterRole of daemonset.yaml grants.
+		Resources: []string{"pods", "replicasets", "jobs"},
+		Pods: []fakehost.KubePod{
+			{Name: "api-7d9f-x2", Namespace: "payments", Uid: "uid-api", NodeName: "node-1", ServiceAccount: "api",
+				Labels: map[string]string{"app": "api"}, Owner: &fakehost.KubeOwner{Kind: "ReplicaSet", Name: "api-7d9f"},
+				Containers: []fakehost.KubeContainer{{Name: "api", Requests: map[string]string{"cpu": "250m"}, Limits: map[string]string{"memory": "256Mi"}}}},
+			{Name: "db-0", Namespace: "payments", Uid: "uid-db", NodeName: "node-1", Owner: &fakehost.KubeOwner{Kind: "StatefulSet", Name: "db"}},
+			{Name: "backup-2890-q", Namespace: "ops", Uid: "uid-backup", NodeName: "node-1", Owner: &fakehost.KubeOwner{Kind: "Job", Name: "backup-2890"}},
+			{Name: "debug", Namespace: "default", Uid: "uid-debug", NodeName: "node-1"},
+			{Name: "web-0", Namespace: "payments", Uid: "uid-web", NodeName: "node-2", Owner: &fakehost.KubeOwner{Kind: "StatefulSet", Name: "web"}},
+		},
+		Objects: []fakehost.KubeObject{
+			{Kind: "ReplicaSet", Namespace: "payments", Name: "api-7d9f", Owner: &fakehost.KubeOwner{Kind: "Deployment", Name: "api"}},
+			{Kind: "Job", Namespace: "ops", Name: "backup-2890", Owner: &fakehost.KubeOwner{Kind: "CronJob", Name: "backup"}},
+		},
+	}
+	config, err := kube.InClusterConfig(h.ServeKube(srv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := kube.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- RunKubeWatcher(ctx, client, "node-1") }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// waitFor polls until the watcher has seen what cond looks for.
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("watcher never saw %s", what)
+			}
+		}
+	}
+	waitFor("the pods of node-1", func() bool {
+		_, ok := getKubePod("uid-debug", "", "")
+		return ok
+	})
+
+	for _, tc := range []struct {
+		metadata ContainerMetadata
+		want     string
+	}{
+		{ContainerMetadata{PodName: "api-7d9f-x2", PodNamespace: "payments", PodUid: "uid-api"}, "deployment payments/api"},
+		{ContainerMetadata{PodName: "db-0", PodNamespace: "payments"}, "statefulset payments/db"},
+		{ContainerMetadata{PodUid: "uid-backup"}, "cronjob ops/backup"},
+		{ContainerMetadata{PodName: "debug", PodNamespace: "default", PodUid: "uid-debug"}, ""},
+		{ContainerMetadata{PodName: "web-0", PodNamespace: "payments", PodUid: "uid-web"}, ""},
+	} {
+		if got := newContainerRef(containerIdOf('a'), "containerd", tc.metadata).Workload; got != tc.want {
+			t.Errorf("workload of %+v: got %q, want %q", tc.metadata, got, tc.want)
+		}
+	}
+
+	info := getKubernetesInfo(ContainerRef{PodUid: "uid-api", ContainerName: "api"})
+	if info == nil || info.WorkloadKind != "Deployment" || info.WorkloadName != "api" || info.ServiceAccount != "api" ||
+		info.Labels["app"] != "api" || info.Requests["cpu"] != "250m" || info.Limits["memory"] != "256Mi" {
+		t.Errorf("got %+v", info)
+	}
+	if info := getKubernetesInfo(ContainerRef{PodUid: "uid-web"}); info != nil {
+		t.Errorf("got %+v for a pod of another node", info)
+	}
+
+	srv.Update(kube.EventModified, fakehost.KubePod{Name: "debug", Namespace: "default", Uid: "uid-debug", NodeName: "node-1",
+		Labels: map[string]string{"app": "debug"}})
+	srv.Update(kube.EventDeleted, fakehost.KubePod{Name: "db-0", Namespace: "payments", Uid: "uid-db", NodeName: "node-1"})
+	waitFor("the deletion of db-0", func() bool {
+		_, ok := getKubePod("uid-db", "payments", "db-0")
+		return !ok
+	})
+	if info := getKubernetesInfo(ContainerRef{PodUid: "uid-debug"}); info == nil || info.Labels["app"] != "debug" {
+		t.Errorf("got %+v after the update", info)
+	}
+}
+
+func TestRunKubeWatcherUnauthorized(t *testing.T) {
+	h := newHost(t)
+	config, err := kube.InClusterConfig(h.ServeKube(&fakehost.KubeServer{Token: "secret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.WriteFile("serviceaccount/token", "other")
+	client, err := kube.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RunKubeWatcher(context.Background(), client, "node-1"); err == nil {
+		t.Error("got no error from a failing first list")
+	}
+	if _, ok := getKubePod("", "default", "debug"); ok {
+		t.Error("got a pod without a watcher")
+	}
+}
@@ -0,0 +1,265 @@
+package module
+
+import (
+	"container-agent/cri"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// Where the metadata of a container comes from.
+const (
+	MetadataSourceCri    = "cri"
+	MetadataSourceDocker = "docker"
+	MetadataSourceFile   = "file"
+)
+
+// ContainerMetadata is what the kubelet, or docker compose, told the
+// runtime about a container. It is asked from the runtime over CRI or the
+// Docker Engine API, or scraped from the runtime's state files when its
+// socket is unavailable, which only have part of it. ImageDigest is the
+// image the runtime resolved Image to. Sandboxes (pause containers) have no
+// ContainerName. upperDir is the overlay upper dir below hostRoot, if the
+// runtime told it.
+type ContainerMetadata struct {
+	PodName        string            `json:"PodName"`
+	PodNamespace   string            `json:"PodNamespace"`
+	PodUid         string            `json:"PodUid"`
+	SandboxId      string            `json:"SandboxId"`
+	ContainerName  string            `json:"ContainerName"`
+	ComposeProject string            `json:"ComposeProject,omitempty"`
+	ComposeService string            `json:"ComposeService,omitempty"`
+	Image          string            `json:"Image"`
+	ImageDigest    string            `json:"ImageDigest"`
+	Labels         map[string]string `json:"Labels,omitempty"`
+	Annotations    map[string]string `json:"Annotations,omitempty"`
+	RestartCount   int               `json:"RestartCount"`
+	Source         string            `json:"Source"`
+	runtime        string
+	upperDir       string
+}
+
+// criEndpoint, if set by ConfigureCri, is the only CRI socket asked,
+// instead of the sockets of the discovered runtimes.
+var criEndpoint string
+
+// ConfigureCri makes the agent ask the CRI socket at endpoint, a host path
+// or unix:// URL, for container metadata instead of the discovered ones.
+// An empty endpoint restores discovery.
+func ConfigureCri(endpoint string) {
+	criEndpoint = endpoint
+}
+
+// criSockets maps the runtimes to ask over CRI to their sockets below
+// hostRoot. docker.sock is the Engine API, not CRI; with cri-dockerd,
+// docker is asked through its socket instead.
+func criSockets(runtimes []Runtime) map[string]string {
+	sockets := make(map[string]string)
+	if criEndpoint != "" {
+		runtime := endpointRuntime(criEndpoint)
+		if runtime == "" {
+			runtime = DefaultRuntime(runtimes)
+		}
+		sockets[runtime] = hostSocketPath(criEndpoint)
+		return sockets
+	}
+	for _, runtime := range runtimes {
+		if runtime.Socket != "" && runtime.Socket != dockerEngineSocket {
+			sockets[runtime.Name] = hostRoot + runtime.Socket
+		}
+	}
+	return sockets
+}
+
+// criClients are the clients of the CRI sockets by path, kept across
+// Monitoring() runs so each runtime is only asked about its new containers.
+// A client whose call fails other than by a timeout is closed and dialed
+// again on the next run.
+var criClients = make(map[string]*cri.Client)
+
+// criClient returns the client of socket, dialing it if there is none.
+func criClient(socket string) (*cri.Client, error) {
+	if client, ok := criClients[socket]; ok {
+		return client, nil
+	}
+	client, err := cri.Dial(socket, cri.DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	criClients[socket] = client
+	return client, nil
+}
+
+// dropCriClient closes the client of socket after a failed call.
+func dropCriClient(socket string) {
+	if client, ok := criClients[socket]; ok {
+		client.Close()
+		delete(criClients, socket)
+	}
+}
+
+// closeCriClients closes the clients of every socket.
+func closeCriClients() {
+	for socket := range criClients {
+		dropCriClient(socket)
+	}
+}
+
+// criVersion asks a CRI runtime for its version.
+func criVersion(socket string) (string, error) {
+	client, err := criClient(socket)
+	if err != nil {
+		return "", err
+	}
+	_, version, err := client.Version()
+	if err != nil && !cri.IsTimeout(err) {
+		dropCriClient(socket)
+	}
+	return version, err
+}
+
+func newCriMetadata(container cri.Container, runtime string) ContainerMetadata {
+	return ContainerMetadata{
+		PodName:       container.PodName,
+		PodNamespace:  container.PodNamespace,
+		PodUid:        container.PodUid,
+		SandboxId:     container.SandboxId,
+		ContainerName: container.Name,
+		Image:         container.Image,
+		ImageDigest:   container.ImageRef,
+		Labels:        container.Labels,
+		Annotations:   container.Annotations,
+		RestartCount:  container.RestartCount,
+		Source:        MetadataSourceCri,
+		runtime:       runtime,
+	}
+}
+
+// setMetadataError logs why runtime couldn't be asked for container
+// metadata and records it in its entry of runtimes, if it has one.
+func setMetadataError(runtimes []Runtime, runtime string, err error) {
+	fmt.Printf("metadata: %s: %s, falling back to the state files\n", runtime, err)
+	for i := range runtimes {
+		if runtimes[i].Name == runtime {
+			runtimes[i].MetadataError = err.Error()
+		}
+	}
+}
+
+// GetContainerMetadata asks every runtime with a CRI socket for its running
+// containers and sandboxes, and docker for its containers over the Engine
+// API, keyed by container ID. Runtimes whose socket doesn't answer are left
+// out, their containers fall back to the state files, and the error is
+// recorded as their MetadataError.
+func GetContainerMetadata(runtimes []Runtime) (map[string]ContainerMetadata, error) {
+	metadataMap := make(map[string]ContainerMetadata)
+
+	for runtime, socket := range criSockets(runtimes) {
+		client, err := criClient(socket)
+		if err != nil {
+			setMetadataError(runtimes, runtime, err)
+			continue
+		}
+		containers, err := client.Containers()
+		if err != nil {
+			if !cri.IsTimeout(err) {
+				dropCriClient(socket)
+			}
+			setMetadataError(runtimes, runtime, err)
+			continue
+		}
+		for _, container := range containers {
+			metadataMap[container.Id] = newCriMetadata(container, runtime)
+		}
+	}
+
+	for _, runtime := range runtimes {
+		if runtime.Name == RuntimeDocker && isSocket(hostRoot+dockerEngineSocket) {
+			if err := getDockerMetadata(metadataMap, time.Now()); err != nil {
+				setMetadataError(runtimes, RuntimeDocker, err)
+			}
+		}
+	}
+
+	return metadataMap, nil
+}
+
+// containerStateJson is the part of a runtime state file holding the
+// kubelet's metadata: docker keeps it as labels of its config.v2.json,
+// containerd and cri-o as annotations of the OCI config.json.
+type containerStateJson struct {
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	Image       string            `json:"Image"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// firstValue returns the value of the first of keys set in labels or
+// annotations.
+func (s containerStateJson) firstValue(keys ...string) string {
+	for _, key := range keys {
+		if value, ok := s.Config.Labels[key]; ok {
+			return value
+		}
+		if value, ok := s.Annotations[key]; ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// readFileMetadata scrapes the metadata of a container from the state file
+// of its runtime.
+func readFileMetadata(containerId string, runtime string) (ContainerMetadata, error) {
+	var state containerStateJson
+
+	content, err := ioutil.ReadFile(containerStateFile(containerId, runtime))
+	if err != nil {
+		return ContainerMetadata{}, err
+	}
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return ContainerMetadata{}, err
+	}
+
+	metadata := ContainerMetadata{
+		PodName:        state.firstValue("io.kubernetes.pod.name", "io.kubernetes.cri.sandbox-name"),
+		PodNamespace:   state.firstValue("io.kubernetes.pod.namespace", "io.kubernetes.cri.sandbox-namespace"),
+		PodUid:         state.firstValue("io.kubernetes.pod.uid", "io.kubernetes.cri.sandbox-uid"),
+		SandboxId:      state.firstValue("io.kubernetes.sandbox.id", "io.kubernetes.cri.sandbox-id", "io.kubernetes.cri-o.SandboxID"),
+		ContainerName:  state.firstValue("io.kubernetes.container.name", "io.kubernetes.cri.container-name"),
+		ComposeProject: state.firstValue("com.docker.compose.project"),
+		ComposeService: state.firstValue("com.docker.compose.service"),
+		Image:          state.Config.Image,
+		ImageDigest:    state.Image,
+		Labels:         state.Config.Labels,
+		Annotations:    state.Annotations,
+		Source:         MetadataSourceFile,
+		runtime:        runtime,
+	}
+	if metadata.Image == "" {
+		metadata.Image = state.firstValue("io.kubernetes.cri.image-name", "io.kubernetes.cri-o.ImageName")
+	}
+	if metadata.ImageDigest == "" {
+		metadata.ImageDigest = state.firstValue("io.kubernetes.cri-o.ImageRef")
+	}
+	restartCount := state.firstValue("io.kubernetes.container.restartCount", "annotation.io.kubernetes.container.restartCount")
+	metadata.RestartCount, _ = strconv.Atoi(restartCount)
+
+	return metadata, nil
+}
+
+// getContainerMetadata returns the metadata of a container from
+// metadataMap, as returned by GetContainerMetadata, or from the state file
+// of its runtime.
+func getContainerMetadata(containerId string, runtime string, metadataMap map[string]ContainerMetadata) ContainerMetadata {
+	if metadata, ok := metadataMap[containerId]; ok {
+		return metadata
+	}
+	metadata, _ := readFileMetadata(containerId, runtime)
+	return metadata
+}
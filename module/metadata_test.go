@@ -0,0 +1,92 @@
+package module
+
+import (
+	"testing"
+
+	"container-agent/fakehost"
+)
+
+func TestGetContainerMetadata(t *testing.T) {
+	h := newHost(t)
+
+	dockerId := containerIdOf('a')
+	containerdId := containerIdOf('b')
+	sandboxId := containerIdOf('c')
+
+	// containerd answers over CRI and has no state files, docker only has
+	// its state files.
+	srv := &fakehost.CriServer{
+		RuntimeName:    "containerd",
+		RuntimeVersion: "v1.6.12",
+		Containers: []fakehost.CriContainer{{
+			Id: containerdId, SandboxId: sandboxId, Name: "redis", PodName: "cache-0", PodNamespace: "shop", PodUid: "uid-1",
+			Image: "docker.io/library/redis:7", ImageRef: "docker.io/library/redis@sha256:def", RestartCount: 3,
+		}},
+	}
+	h.ServeCri("run/containerd/containerd.sock", srv)
+	h.AddDockerContainer(dockerId, "docker-pod", nil)
+
+	h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}})
+	h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Cmdline: []string{"nginx"}, Cgroup: "0::/kubepods/besteffort/pod1/" + dockerId})
+	h.AddProcess(fakehost.Process{Pid: 200, PPid: 1, Cmdline: []string{"/pause"}, Cgroup: "0::/kubepods.slice/cri-containerd-" + sandboxId + ".scope"})
+	h.AddProcess(fakehost.Process{Pid: 201, PPid: 1, Cmdline: []string{"redis-server"}, Cgroup: "0::/kubepods.slice/cri-containerd-" + containerdId + ".scope"})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtimes, err := DiscoverRuntimes(procs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runtimes) != 2 || runtimes[1].Name != RuntimeContainerd || runtimes[1].Version != "v1.6.12" {
+		t.Errorf("got runtimes %+v", runtimes)
+	}
+
+	metadataMap, err := GetContainerMetadata(runtimes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redis := metadataMap[containerdId]
+	if redis.Source != MetadataSourceCri || redis.PodName != "cache-0" || redis.PodNamespace != "shop" || redis.PodUid != "uid-1" ||
+		redis.ContainerName != "redis" || redis.ImageDigest != "docker.io/library/redis@sha256:def" || redis.RestartCount != 3 {
+		t.Errorf("got %+v", redis)
+	}
+	// The next run keeps the connection and only lists.
+	if metadataMap, err := GetContainerMetadata(runtimes); err != nil || metadataMap[containerdId].PodName != "cache-0" || srv.Calls("ContainerStatus") != 1 {
+		t.Errorf("got %+v, %v after %d status calls", metadataMap, err, srv.Calls("ContainerStatus"))
+	}
+
+	pidMap, _ := GetPidMapper(procs)
+	refMap, _, runtimeMap, err := GetContainerId(procs, pidMap, DefaultRuntime(runtimes), metadataMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refMap[200].String() != "shop/cache-0/"+sandboxId || refMap[201].String() != "shop/cache-0/"+containerdId || refMap[100].String() != "docker-pod/"+dockerId {
+		t.Errorf("got %v", refMap)
+	}
+	if runtimeMap[dockerId] != RuntimeDocker || runtimeMap[containerdId] != RuntimeContainerd {
+		t.Errorf("got runtimes %v", runtimeMap)
+	}
+
+	// docker falls back to its state files.
+	nginx := getContainerMetadata(dockerId, RuntimeDocker, metadataMap)
+	if nginx.Source != MetadataSourceFile || nginx.PodName != "docker-pod" {
+		t.Errorf("got %+v", nginx)
+	}
+}
+
+func TestGetContainerMetadataUnavailable(t *testing.T) {
+	h := newHost(t)
+	// A stale socket nobody listens on any more.
+	h.Listen("run/crio/crio.sock").Close()
+
+	runtimes := []Runtime{{Name: RuntimeCrio, Socket: "/run/crio/crio.sock"}}
+	metadataMap, err := GetContainerMetadata(runtimes)
+	if err != nil || len(metadataMap) != 0 {
+		t.Errorf("got %v, %v", metadataMap, err)
+	}
+	if runtimes[0].MetadataError == "" {
+		t.Error("the failure is not recorded for /runtimes")
+	}
+}
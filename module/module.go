@@ -4,350 +4,296 @@ import (
 	"archive/tar"
 	"bufio"
 	"compress/gzip"
+	"container-agent/procfs"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	goruntime "runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func IsInt(dirName string) bool {
-	_, err := strconv.ParseInt(dirName, 10, 64)
-	if err != nil {
-		return false
-	}
-	return true
+// hostRoot is where the host's filesystems are mounted into the agent's
+// container, outputDir where Monitoring() writes its results. Both are set
+// by Configure.
+var (
+	hostRoot   = "/rootfs"
+	outputDir  = "/dist"
+	cgroupRoot = hostRoot + "/sys/fs/cgroup"
+)
+
+// procFS is the host's /proc, every per-process collector reads it
+// through a single readAllProcs() pass per Monitoring() run.
+var procFS = procfs.NewFS(hostRoot + "/proc")
+
+// Configure points the collectors at the host filesystems mounted below
+// root and has Monitoring() write its results to dist. It must be called
+// before the first Monitoring() run.
+func Configure(root string, dist string) {
+	hostRoot = strings.TrimSuffix(root, "/")
+	outputDir = strings.TrimSuffix(dist, "/")
+	cgroupRoot = hostRoot + "/sys/fs/cgroup"
+	procFS = procfs.NewFS(hostRoot + "/proc")
+	bootTime = 0
+	dockerCache = dockerInspectCache{}
+	closeCriClients()
+	kubePodsMutex.Lock()
+	kubePods = nil
+	kubePodsMutex.Unlock()
 }
 
-func GetUptime() (int64, error) {
-	var uptime int64
+// atClkTck is the AT_CLKTCK auxiliary vector entry carrying the kernel's
+// USER_HZ, the unit of every tick counter in /proc/[pid]/stat.
+const atClkTck = 17
+
+// GetClockTicks returns CLK_TCK as reported by the kernel through the
+// auxiliary vector of the agent itself. It falls back to 100, the value
+// used by every mainstream architecture, if the vector can't be read. The
+// vector is only read once, see cachedClockTicks.
+func GetClockTicks() float64 {
+	clockTicksOnce.Do(func() {
+		cachedClockTicks = readClockTicks()
+	})
+	return cachedClockTicks
+}
 
-	file, err := os.Open("/rootfs/proc/uptime")
+func readClockTicks() float64 {
+	auxv, err := ioutil.ReadFile("/proc/self/auxv")
 	if err != nil {
-		return -1, err
+		return 100
 	}
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		var tempFloat float64
-		splitScan := strings.Split(scanner.Text(), " ")
-		tempFloat, err = strconv.ParseFloat(splitScan[0], 64)
-		uptime = (int64)(tempFloat)
-		if err != nil {
-			return -1, err
+	for i := 0; i+16 <= len(auxv); i += 16 {
+		key := binary.LittleEndian.Uint64(auxv[i:])
+		value := binary.LittleEndian.Uint64(auxv[i+8:])
+		if key == atClkTck && value > 0 {
+			return (float64)(value)
 		}
 	}
-	if scanner.Err() != nil {
-		return -1, err
-	}
-
-	return uptime, nil
+	return 100
 }
 
-func GetPidList() ([]string, error) {
-	var pidList []string
-
-	files, err := ioutil.ReadDir("/rootfs/proc/")
-	if err != nil {
-		return pidList, err
-	}
-
-	for _, file := range files {
-		if IsInt(file.Name()) {
-			pidList = append(pidList, file.Name())
-		}
+// GetCpuCount returns the number of CPUs of the node, counted from the
+// host /proc/stat. The agent's own cgroup may be limited to fewer CPUs, so
+// runtime.NumCPU is only used as a fallback.
+func GetCpuCount() int {
+	cpuCount, err := procFS.CpuCount()
+	if err != nil || cpuCount == 0 {
+		return goruntime.NumCPU()
 	}
-
-	return pidList, nil
+	return cpuCount
 }
 
-func GetCpuUsage(dirList []string, uptime int64) ([]string, []float32, []uint64, string, error) {
-	var pNameList []string
-	var cpuUsageList []float32
-	var memUsageList []uint64
-	var kubeletPid string
-	runtime := "docker"
-
-	prefixProc := "/rootfs/proc/"
-	postfixProc := "/stat"
-	for _, dirName := range dirList {
-		statPwd := prefixProc + dirName + postfixProc
-		file, err := os.Open(statPwd)
-		if err != nil {
-			continue
-		}
-
-		var readLine string
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			readLine = scanner.Text()
-		}
-		if scanner.Err() != nil {
-			continue
-		}
+// CpuUsage is the CPU consumption of a process over the last collection
+// interval. PerCore is relative to a single core, so a process spinning two
+// threads shows 200%. Node is the same value normalized by the CPU count of
+// the node, so the sum over all processes never exceeds 100%.
+type CpuUsage struct {
+	PerCore float32
+	Node    float32
+}
 
-		splitReadLine := strings.Split(readLine, " ")
+// cpuSample is the tick counter of a process as seen by the previous
+// Monitoring() run.
+type cpuSample struct {
+	ticks  uint64
+	uptime float64
+}
 
-		if strings.Contains(splitReadLine[1], "kubelet") {
-			kubeletPid = splitReadLine[0]
-			// can't be err
+// prevCpuSamples is only touched by GetCpuUsage, which runs from the
+// singleton Monitoring() job. It is keyed by processKey, so a reused pid
+// is not measured against the process that was sampled before.
+var prevCpuSamples = map[processKey]cpuSample{}
+
+// GetCpuUsage returns the CPU usage of every process in procs, in the same
+// order.
+func GetCpuUsage(procs []procfs.Proc, uptime float64) ([]CpuUsage, error) {
+	cpuUsageList := make([]CpuUsage, 0, len(procs))
+
+	clockTicks := GetClockTicks()
+	cpuCount := GetCpuCount()
+	cpuSamples := make(map[processKey]cpuSample, len(procs))
+
+	for _, proc := range procs {
+		// cutime and cstime are left out on purpose: they jump by the whole
+		// lifetime of a child when it is reaped, and the child's own ticks
+		// have already been reported while it was running.
+		totalTicks := proc.Stat.UTime + proc.Stat.STime
+		starttime := proc.Stat.StartTime
+		key := newProcessKey(proc)
+		cpuSamples[key] = cpuSample{totalTicks, uptime}
+
+		// A process seen by the previous run is measured over the interval
+		// since then. Anything else started during the interval (or this is
+		// the first run), so its lifetime is the best window available.
+		var ticks uint64
+		var seconds float64
+		if prev, ok := prevCpuSamples[key]; ok && uptime > prev.uptime && totalTicks >= prev.ticks {
+			ticks = totalTicks - prev.ticks
+			seconds = uptime - prev.uptime
+		} else {
+			ticks = totalTicks
+			seconds = uptime - (float64)(starttime)/clockTicks
 		}
 
-		utime, err := strconv.ParseFloat(splitReadLine[13], 10)
-		if err != nil {
-			continue
-		}
-		stime, err := strconv.ParseFloat(splitReadLine[14], 10)
-		if err != nil {
-			continue
-		}
-		cutime, err := strconv.ParseFloat(splitReadLine[15], 10)
-		if err != nil {
-			continue
-		}
-		cstime, err := strconv.ParseFloat(splitReadLine[16], 10)
-		if err != nil {
-			continue
-		}
-		starttime, err := strconv.ParseFloat(splitReadLine[21], 10)
-		if err != nil {
-			continue
-		}
-		memUsage, err := strconv.ParseUint(splitReadLine[22], 10, 64)
-		if err != nil {
-			continue
+		var cpuUsage CpuUsage
+		if seconds > 0 {
+			cpuUsage.PerCore = (float32)(100.0 * ((float64)(ticks) / clockTicks) / seconds)
+			cpuUsage.Node = cpuUsage.PerCore / (float32)(cpuCount)
 		}
 
-		totalTime := utime + stime + cutime + cstime
-		seconds := (float64)(uptime) - (starttime / 100)
-		cpuUsage := 100.0 * (float32)(((float32)(totalTime)/100.0)/(float32)(seconds))
-
-		//cpuUsageList = append(cpuUsageList, cpuUsage)
-
-		newpName := fmt.Sprintf("%s", splitReadLine[1][1:len(splitReadLine[1])-1])
-		pNameList = append(pNameList, newpName)
 		cpuUsageList = append(cpuUsageList, cpuUsage)
-		memUsageList = append(memUsageList, memUsage)
-	}
-
-	statPwd := prefixProc + kubeletPid + "/cmdline"
-	file, _ := os.Open(statPwd)
-
-	var readLine string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		readLine = scanner.Text()
 	}
-	splitedCmdline := strings.Split(readLine, "\x00")
+	prevCpuSamples = cpuSamples
 
-	for _, cmd := range splitedCmdline {
-		if strings.Contains(cmd, "container-runtime-endpoint") {
-			temp := strings.Split(cmd, "=")
-			if strings.Contains(temp[1], "crio") {
-				runtime = "crio"
-				break
-			} else if strings.Contains(temp[1], "containerd") {
-				runtime = "containerd"
-				break
-			}
-		}
-	}
-	return pNameList, cpuUsageList, memUsageList, runtime, nil
+	return cpuUsageList, nil
 }
 
-func GetPidMapper(dirList []string) (map[int]int, error) {
-	var pidMap map[int]int
-	pidMap = make(map[int]int)
-
-	prefixProc := "/rootfs/proc/"
-	postfixProc := "/stat"
-	for _, dirName := range dirList {
-		statPwd := prefixProc + dirName + postfixProc
-		file, err := os.Open(statPwd)
-		if err != nil {
-			continue
-		}
-
-		var readLine string
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			readLine = scanner.Text()
-		}
-		if scanner.Err() != nil {
-			continue
-		}
+// MemUsage is the memory footprint of a process in bytes. Rss is what is
+// resident right now, Shared the part of it backed by files or shmem that
+// other processes may map too, and Pss the resident size with every shared
+// page divided among the processes mapping it. VSize is the whole virtual
+// address space and says little about real usage.
+type MemUsage struct {
+	Rss    uint64
+	Shared uint64
+	Pss    uint64
+	Swap   uint64
+	VSize  uint64
+}
 
-		splitReadLine := strings.Split(readLine, " ")
-		pid, err := strconv.ParseInt(splitReadLine[0], 10, 32)
-		if err != nil {
-			continue
-		}
-		ppid, err := strconv.ParseInt(splitReadLine[3], 10, 32)
-		if err != nil {
-			continue
-		}
+// GetMemUsage returns the memory usage of every process in procs, in the
+// same order. Kernel threads have no memory of their own and report 0, as
+// does Pss where smaps_rollup couldn't be read.
+func GetMemUsage(procs []procfs.Proc) ([]MemUsage, error) {
+	memUsageList := make([]MemUsage, 0, len(procs))
 
-		pidMap[(int)(pid)] = (int)(ppid)
+	for _, proc := range procs {
+		memUsageList = append(memUsageList, MemUsage{
+			Rss:    proc.Status.VmRss,
+			Shared: proc.Status.RssFile + proc.Status.RssShmem,
+			Pss:    proc.SmapsRollup.Pss,
+			Swap:   proc.Status.VmSwap,
+			VSize:  proc.Stat.VSize,
+		})
 	}
 
-	return pidMap, nil
+	return memUsageList, nil
 }
 
-func FindRootPid(pidMap map[int]int, nowPid int) (string, error) {
-	var newLine string
-
-	if pidMap[nowPid] == 1 {
-		file, err := os.Open("/rootfs/proc/" + strconv.Itoa(nowPid) + "/cmdline")
-		if err != nil {
-			return "", err
-		}
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			newLine = scanner.Text()
-		}
-		if scanner.Err() != nil {
-			return "", scanner.Err()
-		}
-		if !strings.Contains(newLine, "containerd") && !strings.Contains(newLine, "crio") {
-			return "Host", nil
-		}
-
-		splitLine := strings.Split(newLine, "\x00")
+func GetPidMapper(procs []procfs.Proc) (map[int]int, error) {
+	pidMap := make(map[int]int, len(procs))
 
-		for i := 0; i < len(splitLine); i++ {
-			if splitLine[i] == "-id" {
-				return splitLine[i+1], nil
-			}
-		}
-		return "Host", nil
-	} else if pidMap[nowPid] == 2 {
-		return "Host", nil
-	} else {
-		FindRootPid(pidMap, pidMap[nowPid])
+	for _, proc := range procs {
+		pidMap[proc.Pid] = proc.Stat.PPid
 	}
 
-	return "Host", nil
-}
-
-type JsonAll struct {
-	Config      JsonConfig `json:"Config"`
-	Annotations JsonConfig `json:"annotations"`
-}
-
-type JsonConfig struct {
-	Labels      JsonLabels `json:"Labels"`
-	SandboxName string     `json:"io.kubernetes.cri.sandbox-name,omitempty"`
-	PodName     string     `json:"io.kubernetes.pod.name,omitempty"`
+	return pidMap, nil
 }
 
-type JsonLabels struct {
-	PodName string `json:"io.kubernetes.pod.name,omitempty"`
-}
+// Attribution methods reported next to WhoIsParent.
+const (
+	AttributedByCgroup     = "cgroup"
+	AttributedByParentWalk = "parent-walk"
+)
 
-func GetContainerId(pidMap map[int]int, runtime string) (map[int]string, error) {
-	parameter, contains := func(runtime string) (string, string) {
-		if runtime == "crio" {
-			return "-c", "cri-o"
-		} else {
-			return "-id", "containerd-shim"
-		}
-	}(runtime)
-
-	pidNameMap := make(map[int]string)
-	var err error
-	for a, _ := range pidMap {
-		var whoIsRoot, newLine, containerId string
-		nowPid := a
-		for {
-			err = nil
-			if pidMap[nowPid] == 0 {
-				whoIsRoot = "Host"
-				break
-			} else if pidMap[nowPid] == 1 {
-				file, innerErr := os.Open("/rootfs/proc/" + strconv.Itoa(nowPid) + "/cmdline")
-				if innerErr != nil {
-					err = innerErr
-					break
-				}
-				scanner := bufio.NewScanner(file)
-				for scanner.Scan() {
-					newLine = scanner.Text()
-				}
-				if scanner.Err() != nil {
-					err = innerErr
-					break
-				}
-				if !strings.Contains(newLine, contains) {
-					whoIsRoot = "Host"
-					err = nil
-					break
+// findShimContainerId walks up the parents of pid until it reaches a child
+// of PID 1. If that is a runtime's shim, the container ID is taken from its
+// command line and the runtime from the shim: conmon for cri-o, the
+// containerd shim for containerd, or for docker when it runs in the moby
+// namespace. This is only a fallback for processes whose cgroup doesn't
+// reveal their container.
+func findShimContainerId(pidMap map[int]int, cmdlineMap map[int][]string, pid int) (string, string) {
+	nowPid := pid
+	for {
+		if pidMap[nowPid] == 0 || pidMap[nowPid] == 2 {
+			return "", ""
+		} else if pidMap[nowPid] == 1 {
+			// The shim itself runs on behalf of the host.
+			if nowPid == pid {
+				return "", ""
+			}
+			splitNewline := cmdlineMap[nowPid]
+			cmdline := strings.Join(splitNewline, " ")
+
+			var parameter, runtime string
+			if strings.Contains(cmdline, "containerd-shim") {
+				parameter, runtime = "-id", RuntimeContainerd
+				if strings.Contains(cmdline, "-namespace moby") {
+					runtime = RuntimeDocker
 				}
+			} else if strings.Contains(cmdline, "conmon") || strings.Contains(cmdline, "cri-o") {
+				parameter, runtime = "-c", RuntimeCrio
+			} else {
+				return "", ""
+			}
 
-				//containerId = newLine[strings.Index(newLine, "-id")+4 : strings.Index(newLine, "-address")-1]
-				splitNewline := strings.Split(newLine, "\x00")
-
-				for i := 0; i < len(splitNewline); i++ {
-					if splitNewline[i] == parameter {
-						containerId = splitNewline[i+1]
-						break
-					}
+			for i := 0; i+1 < len(splitNewline); i++ {
+				if splitNewline[i] == parameter {
+					return splitNewline[i+1], runtime
 				}
-
-				whoIsRoot = "Container"
-				break
-			} else if pidMap[nowPid] == 2 {
-				whoIsRoot = "Host"
-				err = nil
-				break
 			}
-			if err != nil {
-				break
-			}
-			nowPid = pidMap[nowPid]
+			return "", ""
 		}
-		if whoIsRoot == "Container" {
-			var newJson string
-			var newJsonStruct JsonAll
-			var file *os.File
-
-			if runtime == "crio" {
-				file, err = os.Open("/rootfs/containers/storage/overlay-containers/" + containerId + "/userdata/config.json")
-			} else if runtime == "containerd" {
-				file, err = os.Open("/rootfs/k8s.io/" + containerId + "/config.json")
-			} else if runtime == "docker" {
-				file, err = os.Open("/rootfs/docker/containers/" + containerId + "/config.v2.json")
-			}
-			if err != nil {
-				continue
-			}
-
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				newJson += scanner.Text()
-			}
-			if scanner.Err() != nil {
-				continue
-			}
-			err = json.Unmarshal([]byte(newJson), &newJsonStruct)
+		nowPid = pidMap[nowPid]
+	}
+}
 
-			// fmt.Println(newJsonStruct)
+// GetContainerId attributes every process to the container it runs in, or
+// to hostRef. The container is taken from the process's cgroup, which works
+// regardless of PID namespaces and reparenting; only when that fails are
+// the parents walked up to the runtime's shim. The second map tells which
+// of the two methods attributed each pid, the third which runtime owns each
+// container.
+//
+// runtime is the node's default runtime, used when neither the cgroup
+// layout, the runtimes' metadataMap nor their state directories tell the
+// owner. Pods come from metadataMap, as returned by GetContainerMetadata,
+// or else from the state directories. Containers found in neither keep
+// their ID and runtime without a pod.
+func GetContainerId(procs []procfs.Proc, pidMap map[int]int, runtime string, metadataMap map[string]ContainerMetadata) (map[int]ContainerRef, map[int]string, map[string]string, error) {
+	refMap := make(map[int]ContainerRef)
+	methodMap := make(map[int]string)
+	runtimeMap := make(map[string]string)
+	refs := make(map[string]ContainerRef)
+
+	cmdlineMap := make(map[int][]string, len(procs))
+	for _, proc := range procs {
+		cmdlineMap[proc.Pid] = proc.Cmdline
+	}
+
+	for _, proc := range procs {
+		a := proc.Pid
+		method := AttributedByCgroup
+		containerId, containerRuntime := GetContainerCgroup(proc.Cgroups)
+		if containerId == "" {
+			method = AttributedByParentWalk
+			containerId, containerRuntime = findShimContainerId(pidMap, cmdlineMap, a)
+		}
+
+		if containerId == "" {
+			refMap[a] = hostRef
+			methodMap[a] = method
+			continue
+		}
 
-			if runtime == "crio" {
-				whoIsRoot = newJsonStruct.Annotations.PodName + "/" + containerId
-			} else if runtime == "containerd" {
-				whoIsRoot = newJsonStruct.Annotations.SandboxName + "/" + containerId
-			} else if runtime == "docker" {
-				whoIsRoot = newJsonStruct.Config.Labels.PodName + "/" + containerId
-			}
+		ref, ok := refs[containerId]
+		if !ok {
+			ref = resolveContainerRef(containerId, containerRuntime, runtime, metadataMap)
+			refs[containerId] = ref
 		}
-		pidNameMap[a] = whoIsRoot
+		refMap[a] = ref
+		methodMap[a] = method
+		runtimeMap[containerId] = ref.Runtime
 	}
 
-	return pidNameMap, nil
+	return refMap, methodMap, runtimeMap, nil
 }
 
 type JsonSha256 struct {
@@ -377,7 +323,7 @@ func GetParsedSha256() (map[string](map[string]bool), error) {
 	imageMap := map[string](map[string]bool){}
 	// listMap := map[string][]string{}
 	layerChecker := map[string]bool{}
-	sha256Prefix := "/rootfs/sha256/"
+	sha256Prefix := hostRoot + "/sha256/"
 	files, err := ioutil.ReadDir(sha256Prefix)
 	if err != nil {
 		return imageMap, err
@@ -403,6 +349,7 @@ func GetParsedSha256() (map[string](map[string]bool), error) {
 			for scanner.Scan() {
 				fileContent += scanner.Text()
 			}
+			sha256.Close()
 			if scanner.Err() != nil {
 				continue
 			}
@@ -425,6 +372,7 @@ func GetParsedSha256() (map[string](map[string]bool), error) {
 
 			layerMap[jsonSha256.ShaConfig.Digest] = layerList
 		} else {
+			sha256.Close()
 			continue
 		}
 		_ = gz
@@ -442,6 +390,7 @@ func GetParsedSha256() (map[string](map[string]bool), error) {
 		for scanner.Scan() {
 			temp += scanner.Text()
 		}
+		cc.Close()
 		if scanner.Err() != nil {
 			continue
 		}
@@ -470,6 +419,7 @@ func GetParsedSha256() (map[string](map[string]bool), error) {
 
 			gz, err := gzip.NewReader(file)
 			if err != nil {
+				file.Close()
 				continue
 			}
 
@@ -485,6 +435,7 @@ func GetParsedSha256() (map[string](map[string]bool), error) {
 					fileMap[header.Name] = true
 				}
 			}
+			file.Close()
 		}
 		if flag {
 			continue
@@ -516,131 +467,122 @@ type JsonAnno struct {
 	SandboxId     string `json:"io.kubernetes.cri.sandbox-id"`
 }
 
-func GetFileSystemDir(containerIds []string, pidNameMap map[int]string, runtime string) ([]string, error) {
-	diffLayerDirList := make([]string, 0)
-	realContainer := map[string]string{}
+// getContainerdDiffDirs maps the ID of every containerd container to the
+// upper dir of its rootfs mount, found in PID 1's mount table.
+func getContainerdDiffDirs() (map[string]string, error) {
 	diffLayerMap := map[string]string{}
 
-	if runtime == "containerd" {
-		dir := "/rootfs/proc/1/mounts"
-		file, err := os.Open(dir)
-		if err != nil {
-			return diffLayerDirList, err
-		}
+	dir := procFS.Path("1", "mounts")
+	file, err := os.Open(dir)
+	if err != nil {
+		return diffLayerMap, err
+	}
+	defer file.Close()
 
-		var diffLayerDir, key string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		newLine := scanner.Text()
+		splitNewLine := strings.Split(newLine, " ")
+		if splitNewLine[0] == "overlay" {
+			tempSplit := strings.Split(splitNewLine[3], ",")
+			tempSplit2 := strings.Split(tempSplit[3], "=")[1]
+			tempSplit3 := strings.Split(splitNewLine[1], "/")
 
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			newLine := scanner.Text()
-			splitNewLine := strings.Split(newLine, " ")
-			if splitNewLine[0] == "overlay" {
-				tempSplit := strings.Split(splitNewLine[3], ",")
-				tempSplit2 := strings.Split(tempSplit[3], "=")[1]
-				tempSplit3 := strings.Split(splitNewLine[1], "/")
-
-				key = tempSplit3[5]
-				diffLayerDir = strings.Replace(tempSplit2, "/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs/", "/rootfs/", 1)
-				diffLayerMap[key] = diffLayerDir
-			}
-		}
-		if scanner.Err() != nil {
-			return diffLayerDirList, err
+			key := tempSplit3[5]
+			diffLayerMap[key] = strings.Replace(tempSplit2, "/var/lib/containerd/io.containerd.snapshotter.v1.overlayfs/", hostRoot+"/", 1)
 		}
+	}
+	return diffLayerMap, scanner.Err()
+}
 
-		contPrefix := "/rootfs/k8s.io/"
-		contPostfix := "/config.json"
-		contIds := make([]string, 0)
-		files, err := ioutil.ReadDir(contPrefix)
-		if err != nil {
-			return diffLayerDirList, err
-		}
+// getContainerdDiffDir returns the upper dir of a containerd container.
+// Sandboxes (pause containers) are left out, their upper dir holds nothing
+// of interest.
+func getContainerdDiffDir(containerId string, diffLayerMap map[string]string) string {
+	var jsonContainerd JsonContainerd
 
-		for _, file := range files {
-			contIds = append(contIds, file.Name())
-		}
+	content, err := ioutil.ReadFile(hostRoot + "/k8s.io/" + containerId + "/config.json")
+	if err == nil {
+		err = json.Unmarshal(content, &jsonContainerd)
+	}
+	if err != nil || jsonContainerd.Annotations.ContainerType != "container" {
+		return ""
+	}
+	return diffLayerMap[containerId]
+}
 
-		for _, contId := range contIds {
-			jsonContainerd := JsonContainerd{}
+// getStateDiffDir returns the upper dir of a docker or cri-o container, the
+// sibling of the rootfs in its runtime state. It is empty if there is no
+// state or the rootfs is outside the runtime's storage.
+func getStateDiffDir(containerId string, runtime string) (string, error) {
+	var jsonState JsonState
 
-			var fileContent string
-			pwd := contPrefix + contId + contPostfix
-			file, err := os.Open(pwd)
-			if err != nil {
-				continue
-			}
-
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				fileContent = fileContent + scanner.Text()
-			}
-			if scanner.Err() != nil {
-				continue
-			}
+	fullStateDir := hostRoot + "/moby/" + containerId + "/state.json"
+	if runtime == RuntimeCrio {
+		fullStateDir = hostRoot + "/containers/storage/overlay-containers/" + containerId + "/userdata/config.json"
+	}
 
-			err = json.Unmarshal([]byte(fileContent), &jsonContainerd)
+	content, err := ioutil.ReadFile(fullStateDir)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
 
-			if err != nil {
-				continue
-			}
+	err = json.Unmarshal(content, &jsonState)
+	if err != nil {
+		return "", err
+	}
 
-			if jsonContainerd.Annotations.ContainerType == "container" {
-				if _, ok := realContainer[jsonContainerd.Annotations.SandboxId]; !ok {
-					realContainer[jsonContainerd.Annotations.SandboxId] = contId
-					diffLayerDirList = append(diffLayerDirList, diffLayerMap[contId])
-				}
-			}
+	var mergedLayerDir string
+	if runtime == RuntimeCrio {
+		if i := strings.Index(jsonState.Root.Path, "/containers/"); i >= 0 {
+			mergedLayerDir = hostRoot + jsonState.Root.Path[i:]
 		}
 	} else {
-		prefixState := func(runtime string) string {
-			if runtime == "docker" {
-				return "/rootfs/moby/"
-			} else { //crio
-				return "/rootfs/containers/storage/overlay-containers/"
-			}
-		}(runtime)
-		postfixState := func(runtime string) string {
-			if runtime == "docker" {
-				return "/state.json"
-			} else {
-				return "/userdata/config.json"
-			}
-		}(runtime)
-
-		for _, containerId := range containerIds {
-			var newJson, mergedLayerDir string
-			var jsonState JsonState
+		mergedLayerDir = dockerHostPath(jsonState.ConfigFS.RootFS)
+	}
+	if mergedLayerDir == "" {
+		return "", nil
+	}
 
-			fullStateDir := prefixState + containerId + postfixState
+	return filepath.Join(filepath.Dir(mergedLayerDir), "diff"), nil
+}
 
-			file, err := os.Open(fullStateDir)
-			if err != nil {
-				return diffLayerDirList, err
-			}
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				newJson += scanner.Text()
-			}
-			if scanner.Err() != nil {
-				return diffLayerDirList, scanner.Err()
-			}
+// GetFileSystemDir returns the overlay upper (diff) dir of each container,
+// in the order of containerIds, as the runtime told it in metadataMap or
+// else looked up in the state of the runtime runtimeMap says owns it. It is
+// empty for containerd sandboxes and containers whose state or mount wasn't
+// found, or whose state couldn't be read.
+func GetFileSystemDir(containerIds []string, refMap map[int]ContainerRef, runtimeMap map[string]string, metadataMap map[string]ContainerMetadata) ([]string, error) {
+	diffLayerDirList := make([]string, 0, len(containerIds))
+	var diffLayerMap map[string]string
+
+	for _, containerId := range containerIds {
+		if upperDir := metadataMap[containerId].upperDir; upperDir != "" {
+			diffLayerDirList = append(diffLayerDirList, upperDir)
+			continue
+		}
 
-			err = json.Unmarshal([]byte(newJson), &jsonState)
-			if err != nil {
-				return diffLayerDirList, err
-			}
-			mergedLayerDir = func(runtime string) string {
-				if runtime == "docker" {
-					return "/rootfs" + jsonState.ConfigFS.RootFS[strings.Index(jsonState.ConfigFS.RootFS, "/docker"):]
-				} else {
-					return "/rootfs" + jsonState.Root.Path[strings.Index(jsonState.Root.Path, "/containers"):]
+		runtime := runtimeMap[containerId]
+		if runtime == RuntimeContainerd {
+			if diffLayerMap == nil {
+				var err error
+				diffLayerMap, err = getContainerdDiffDirs()
+				if err != nil {
+					return diffLayerDirList, err
 				}
-			}(runtime)
-
-			diffLayerDir := strings.Replace(mergedLayerDir, "merged", "diff", 1)
+			}
+			diffLayerDirList = append(diffLayerDirList, getContainerdDiffDir(containerId, diffLayerMap))
+			continue
+		}
 
-			diffLayerDirList = append(diffLayerDirList, diffLayerDir)
+		diffLayerDir, err := getStateDiffDir(containerId, runtime)
+		if err != nil {
+			// The other containers are still listed.
+			fmt.Println("filesystem dir:", containerId, err)
 		}
+		diffLayerDirList = append(diffLayerDirList, diffLayerDir)
 	}
 
 	return diffLayerDirList, nil
@@ -695,9 +637,8 @@ func Walk(filePath string) error {
 }
 
 type MergedList struct {
-	PodName     string   `json:"PodName"`
-	ContainerId string   `json:"ContainerId"`
-	FileList    []string `json:"DiffFileList"`
+	ContainerRef
+	FileList []string `json:"DiffFileList"`
 }
 
 type DirWalker struct {
@@ -705,19 +646,21 @@ type DirWalker struct {
 	FileList []string
 }
 
-func GetPodInfo(podNames []string, containerIds []string, diffList []string, runtime string) (string, error) {
+// GetPodInfo lists the files in the upper dir of each container of refs,
+// diffList being their upper dirs as returned by GetFileSystemDir.
+func GetPodInfo(refs []ContainerRef, diffList []string) (string, error) {
 	var jsonMerged []byte
 	var tempMergedList []MergedList
 
 	for i := 0; i < len(diffList); i++ {
+		if diffList[i] == "" {
+			continue
+		}
 		dirWalker = DirWalker{"", make([]string, 0)}
 		diff := diffList[i]
-		containerId := containerIds[i]
-		podName := podNames[i]
 		var tempMerged MergedList
 
-		tempMerged.PodName = podName
-		tempMerged.ContainerId = containerId
+		tempMerged.ContainerRef = refs[i]
 		dirWalker.Root = diff
 		err := Walk(diff + "/" /*, 0, int(depth)*/)
 		if err != nil {
@@ -738,35 +681,98 @@ func GetPodInfo(podNames []string, containerIds []string, diffList []string, run
 }
 
 type ProcessInfo struct {
-	ProcessName string `json:"ProcessName"`
-	CpuUsage    string `json:"CpuUsage"`
-	MemUsage    string `json:"MemoryUsage"`
-	ProcessId   string `json:"ProcessId"`
-	WhoIsParent string `json:"WhoIsParent"`
+	ProcessName  string          `json:"ProcessName"`
+	Cmdline      string          `json:"Cmdline"`
+	Cwd          string          `json:"Cwd"`
+	Exe          string          `json:"Exe"`
+	ExeSha256    string          `json:"ExeSha256"`
+	ExeOrigin    string          `json:"ExeOrigin"`
+	Drift        bool            `json:"Drift"`
+	Environ      []string        `json:"Environ,omitempty"`
+	CpuUsage     string          `json:"CpuUsage"`
+	NodeCpuUsage string          `json:"NodeCpuUsage"`
+	MemRss       string          `json:"MemoryRss"`
+	MemShared    string          `json:"MemoryShared"`
+	MemPss       string          `json:"MemoryPss"`
+	MemSwap      string          `json:"MemorySwap"`
+	MemVirtual   string          `json:"MemoryVirtual"`
+	Io           IoRates         `json:"Io"`
+	Injection    *Injection      `json:"Injection,omitempty"`
+	ProcessId    string          `json:"ProcessId"`
+	ProcessKey   string          `json:"ProcessKey"`
+	StartTime    string          `json:"StartTime"`
+	Age          string          `json:"Age"`
+	WhoIsParent  ContainerRef    `json:"WhoIsParent"`
+	AttributedBy string          `json:"AttributedBy"`
+	Security     ProcessSecurity `json:"Security"`
 }
 
-func WriteFile(filePath string, pNameList []string, cpuList []float32, memList []uint64, pidList []string, pidNameMap map[int]string, jsonMerged string) error {
-	processInfo := make([]ProcessInfo, 0)
-	for i := 0; i < len(pNameList); i++ {
-		var temp ProcessInfo
-		pid, err := strconv.Atoi(pidList[i])
-		if err != nil {
-			return err
-		}
-		temp = ProcessInfo{pNameList[i], fmt.Sprintf("%.3f%%", cpuList[i]), fmt.Sprintf("%dMB", memList[i]/1024/1024), pidList[i], pidNameMap[pid]}
-		processInfo = append(processInfo, temp)
+func formatMB(bytes uint64) string {
+	return fmt.Sprintf("%.1fMB", (float64)(bytes)/1024/1024)
+}
+
+func newProcessInfo(proc procfs.Proc, cpuUsage CpuUsage, memUsage MemUsage, ioUsage IoUsage, exeInfo ExeInfo, injection Injection, whoIsParent ContainerRef, attributedBy string, now time.Time) ProcessInfo {
+	processInfo := ProcessInfo{
+		ProcessName:  proc.Stat.Comm,
+		Cmdline:      proc.CmdlineString(),
+		Cwd:          proc.Cwd,
+		Exe:          proc.Exe,
+		ExeSha256:    exeInfo.Sha256,
+		ExeOrigin:    exeInfo.Origin,
+		Drift:        exeInfo.IsDrift(),
+		CpuUsage:     fmt.Sprintf("%.3f%%", cpuUsage.PerCore),
+		NodeCpuUsage: fmt.Sprintf("%.3f%%", cpuUsage.Node),
+		MemRss:       formatMB(memUsage.Rss),
+		MemShared:    formatMB(memUsage.Shared),
+		MemPss:       formatMB(memUsage.Pss),
+		MemSwap:      formatMB(memUsage.Swap),
+		MemVirtual:   formatMB(memUsage.VSize),
+		Io:           newIoRates(ioUsage),
+		ProcessId:    strconv.Itoa(proc.Pid),
+		ProcessKey:   newProcessKey(proc).String(),
+		StartTime:    formatStartTime(proc.Stat.StartTime),
+		Age:          formatAge(proc.Stat.StartTime, now),
+		WhoIsParent:  whoIsParent,
+		AttributedBy: attributedBy,
+		Security:     GetProcessSecurity(proc),
+	}
+	if captureEnviron {
+		processInfo.Environ = proc.Environ
+	}
+	if !injection.IsEmpty() {
+		processInfo.Injection = &injection
+	}
+	return processInfo
+}
+
+// sortByUsage orders the indexes of the process lists by CPU usage, then by
+// resident memory, busiest first. It compares the raw numbers, since the
+// formatted strings don't sort numerically ("9.000%" > "10.000%").
+func sortByUsage(cpuList []CpuUsage, memList []MemUsage) []int {
+	order := make([]int, len(cpuList))
+	for i := range order {
+		order[i] = i
 	}
 
-	sort.Slice(processInfo, func(i, j int) bool {
-		if processInfo[i].CpuUsage > processInfo[j].CpuUsage {
-			return true
-		} else if processInfo[i].CpuUsage == processInfo[j].CpuUsage {
-			return processInfo[i].MemUsage > processInfo[j].MemUsage
-		} else {
-			return false
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if cpuList[a].PerCore != cpuList[b].PerCore {
+			return cpuList[a].PerCore > cpuList[b].PerCore
 		}
+		return memList[a].Rss > memList[b].Rss
 	})
 
+	return order
+}
+
+func WriteFile(filePath string, procs []procfs.Proc, cpuList []CpuUsage, memList []MemUsage, ioList []IoUsage, exeList []ExeInfo, injectionList []Injection, refMap map[int]ContainerRef, methodMap map[int]string, jsonMerged string) error {
+	processInfo := make([]ProcessInfo, 0)
+	now := time.Now()
+	for _, i := range sortByUsage(cpuList, memList) {
+		pid := procs[i].Pid
+		processInfo = append(processInfo, newProcessInfo(procs[i], cpuList[i], memList[i], ioList[i], exeList[i], injectionList[i], refMap[pid], methodMap[pid], now))
+	}
+
 	toy, err := json.MarshalIndent(processInfo, "", "  ")
 	if err != nil {
 		return err
@@ -791,28 +797,14 @@ func WriteFile(filePath string, pNameList []string, cpuList []float32, memList [
 	return nil
 }
 
-func GetPidInfo(pNameList []string, cpuList []float32, memList []uint64, pidList []string, pidNameMap map[int]string) (string, error) {
+func GetPidInfo(procs []procfs.Proc, cpuList []CpuUsage, memList []MemUsage, ioList []IoUsage, exeList []ExeInfo, injectionList []Injection, refMap map[int]ContainerRef, methodMap map[int]string) (string, error) {
 	processInfo := make([]ProcessInfo, 0)
-	for i := 0; i < len(pNameList); i++ {
-		var temp ProcessInfo
-		pid, err := strconv.Atoi(pidList[i])
-		if err != nil {
-			return "", err
-		}
-		temp = ProcessInfo{pNameList[i], fmt.Sprintf("%.3f%%", cpuList[i]), fmt.Sprintf("%dMB", memList[i]/1024/1024), pidList[i], pidNameMap[pid]}
-		processInfo = append(processInfo, temp)
+	now := time.Now()
+	for _, i := range sortByUsage(cpuList, memList) {
+		pid := procs[i].Pid
+		processInfo = append(processInfo, newProcessInfo(procs[i], cpuList[i], memList[i], ioList[i], exeList[i], injectionList[i], refMap[pid], methodMap[pid], now))
 	}
 
-	sort.Slice(processInfo, func(i, j int) bool {
-		if processInfo[i].CpuUsage > processInfo[j].CpuUsage {
-			return true
-		} else if processInfo[i].CpuUsage == processInfo[j].CpuUsage {
-			return processInfo[i].MemUsage > processInfo[j].MemUsage
-		} else {
-			return false
-		}
-	})
-
 	jsonData, err := json.MarshalIndent(processInfo, "", "  ")
 	if err != nil {
 		return "", err
@@ -822,76 +814,189 @@ func GetPidInfo(pNameList []string, cpuList []float32, memList []uint64, pidList
 }
 
 func Monitoring() {
-	uptime, err := GetUptime()
+	uptime, err := procFS.Uptime()
+	if err != nil {
+		panic(err)
+	}
+
+	procs, err := readAllProcs()
+	if err != nil {
+		panic(err)
+	}
+
+	cpuList, err := GetCpuUsage(procs, uptime)
+	if err != nil {
+		panic(err)
+	}
+
+	memList, err := GetMemUsage(procs)
+	if err != nil {
+		panic(err)
+	}
+
+	ioList, err := GetIoUsage(procs, uptime)
 	if err != nil {
 		panic(err)
 	}
 
-	pidList, err := GetPidList()
+	pidMap, err := GetPidMapper(procs)
 	if err != nil {
 		panic(err)
 	}
 
-	pNameList, cpuList, memList, runtime, err := GetCpuUsage(pidList, uptime)
+	runtimes, err := DiscoverRuntimes(procs)
 	if err != nil {
 		panic(err)
 	}
+	runtime := DefaultRuntime(runtimes)
 
-	pidMap, err := GetPidMapper(pidList)
+	metadataMap, err := GetContainerMetadata(runtimes)
 	if err != nil {
 		panic(err)
 	}
 
-	pidNameMap, err := GetContainerId(pidMap, runtime)
+	refMap, methodMap, runtimeMap, err := GetContainerId(procs, pidMap, runtime, metadataMap)
 	if err != nil {
 		panic(err)
 	}
 
-	var ids, pods []string
+	var ids []string
+	var refs []ContainerRef
 	containerIds := make(map[string]bool)
 
-	for _, pidName := range pidNameMap {
-		if pidName != "Host" {
-			temp := strings.Split(pidName, "/")
-			if len(temp) > 1 {
-				containerId := temp[1]
-				if _, ok := containerIds[containerId]; !ok {
-					containerIds[containerId] = true
-					pods = append(pods, temp[0])
-					ids = append(ids, containerId)
-				}
+	for _, ref := range refMap {
+		if !ref.IsHost() {
+			if _, ok := containerIds[ref.ContainerId]; !ok {
+				containerIds[ref.ContainerId] = true
+				refs = append(refs, ref)
+				ids = append(ids, ref.ContainerId)
 			}
 		}
 	}
 
-	diffList, err := GetFileSystemDir(ids, pidNameMap, runtime)
+	diffList, err := GetFileSystemDir(ids, refMap, runtimeMap, metadataMap)
+	if err != nil {
+		panic(err)
+	}
+
+	exeList, err := GetExeInfo(procs, refMap, ids, diffList)
+	if err != nil {
+		panic(err)
+	}
+
+	mappingMap := GetMappings(procs)
+
+	injectionList, err := GetInjectionInfo(procs, mappingMap, refMap, ids, diffList)
 	if err != nil {
 		panic(err)
 	}
 
-	if _, err := os.Stat("/dist"); err != nil {
-		err := os.MkdirAll("/dist", 644)
+	if _, err := os.Stat(outputDir); err != nil {
+		err := os.MkdirAll(outputDir, 0755)
 		if err != nil {
 			panic(err)
 		}
 	}
 
-	PidInfo, err := GetPidInfo(pNameList, cpuList, memList, pidList, pidNameMap)
+	PidInfo, err := GetPidInfo(procs, cpuList, memList, ioList, exeList, injectionList, refMap, methodMap)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(outputDir+"/pidinfo", []byte(PidInfo), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	ContainerInfo, err := GetContainerInfo(procs, cpuList, memList, ioList, exeList, refMap, metadataMap)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(outputDir+"/containerinfo", []byte(ContainerInfo), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	ProcTree, err := GetProcTree(procs, cpuList, memList, pidMap, refMap)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(outputDir+"/proctree", []byte(ProcTree), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	NamespaceInfo, err := GetNamespaceInfo(procs, refMap)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(outputDir+"/namespaces", []byte(NamespaceInfo), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	DetectOomKills(procs, refMap, time.Now())
+	DetectStuckProcesses(procs, refMap, time.Now())
+
+	ProcessEvents, err := GetProcessEvents(procs, refMap, time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(outputDir+"/events", []byte(ProcessEvents), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	ConnectionInfo, err := GetConnectionInfo(procs, refMap)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(outputDir+"/connections", []byte(ConnectionInfo), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	Findings, err := GetFindings(procs, mappingMap, refMap, injectionList)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(outputDir+"/findings", []byte(Findings), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	NodeInfo, err := GetNodeInfo(uptime)
+	if err != nil {
+		panic(err)
+	}
+
+	err = ioutil.WriteFile(outputDir+"/node", []byte(NodeInfo), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	RuntimeInfo, err := GetRuntimeInfo(runtimes, runtimeMap)
 	if err != nil {
 		panic(err)
 	}
 
-	err = ioutil.WriteFile("/dist/pidinfo", []byte(PidInfo), 0644)
+	err = ioutil.WriteFile(outputDir+"/runtimes", []byte(RuntimeInfo), 0644)
 	if err != nil {
 		panic(err)
 	}
 
-	PodInfo, err := GetPodInfo(pods, ids, diffList, runtime)
+	PodInfo, err := GetPodInfo(refs, diffList)
 	if err != nil {
 		panic(err)
 	}
 
-	err = ioutil.WriteFile("/dist/podinfo", []byte(PodInfo), 0644)
+	err = ioutil.WriteFile(outputDir+"/podinfo", []byte(PodInfo), 0644)
 	if err != nil {
 		panic(err)
 	}
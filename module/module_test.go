@@ -0,0 +1,259 @@
+package module
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"container-agent/fakehost"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// assertGolden compares got to testdata/<name>.golden, or rewrites the
+// file when the tests run with -update.
+func assertGolden(t *testing.T, name string, got string) {
+	t.Helper()
+	golden := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("%s mismatch (rerun with -update if intended)\n--- got\n%s\n--- want\n%s", golden, got, want)
+	}
+}
+
+// newHost creates a fake host and points the collectors at it.
+func newHost(t *testing.T) *fakehost.Host {
+	h := fakehost.New(t)
+	Configure(h.Root, t.TempDir())
+	t.Cleanup(func() { Configure("/rootfs", "/dist") })
+	return h
+}
+
+func containerIdOf(c byte) string {
+	return strings.Repeat(string(c), 64)
+}
+
+func podRef(podName string, containerId string) ContainerRef {
+	return ContainerRef{PodName: podName, ContainerId: containerId}
+}
+
+func TestGetCpuUsage(t *testing.T) {
+	h := newHost(t)
+	prevCpuSamples = map[processKey]cpuSample{}
+	t.Cleanup(func() { prevCpuSamples = map[processKey]cpuSample{} })
+
+	hz := GetClockTicks()
+	ticks := func(seconds float64) uint64 { return (uint64)(seconds * hz) }
+	// getUsage samples at uptime and returns the usage by pid.
+	getUsage := func(uptime float64) map[int]CpuUsage {
+		t.Helper()
+		procs, err := procFS.AllProcs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cpuList, err := GetCpuUsage(procs, uptime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		usage := make(map[int]CpuUsage)
+		for i, proc := range procs {
+			usage[proc.Pid] = cpuList[i]
+		}
+		return usage
+	}
+	assertUsage := func(what string, got CpuUsage, perCore float64) {
+		t.Helper()
+		// The fake host has two CPUs.
+		if math.Abs((float64)(got.PerCore)-perCore) > 0.01 || math.Abs((float64)(got.Node)-perCore/2) > 0.01 {
+			t.Errorf("%s: got %+v, want %.2f%% per core", what, got, perCore)
+		}
+	}
+
+	h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Comm: "nginx", StartTime: ticks(100), UTime: ticks(10), STime: ticks(8)})
+	h.AddProcess(fakehost.Process{Pid: 200, PPid: 1, Comm: "cron", StartTime: ticks(500), UTime: ticks(1)})
+	usage := getUsage(1000)
+	// Without a previous sample, over the lifetime.
+	assertUsage("nginx, first run", usage[100], 100*18.0/900)
+	assertUsage("cron, first run", usage[200], 100*1.0/500)
+
+	// nginx ran two threads for the whole 10s interval. cron exited and
+	// its pid went to a process started 5s ago, which ran 3s.
+	h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Comm: "nginx", StartTime: ticks(100), UTime: ticks(22), STime: ticks(16)})
+	h.AddProcess(fakehost.Process{Pid: 200, PPid: 1, Comm: "backup", StartTime: ticks(1005), UTime: ticks(2), STime: ticks(1)})
+	usage = getUsage(1010)
+	assertUsage("nginx, over the interval", usage[100], 200)
+	assertUsage("reused pid", usage[200], 100*3.0/5)
+}
+
+func TestGetContainerId(t *testing.T) {
+	h := newHost(t)
+
+	dockerId := containerIdOf('a')
+	containerdId := containerIdOf('b')
+	crioId := containerIdOf('c')
+	shimId := containerIdOf('d')
+	cgroupfsId := containerIdOf('e')
+	goneId := containerIdOf('f')
+
+	h.AddDockerContainer(dockerId, "docker-pod", nil)
+	h.AddContainerdContainer(fakehost.ContainerdContainer{Id: containerdId, SandboxName: "containerd-pod", Type: "container", Snapshot: 2})
+	h.AddContainerdContainer(fakehost.ContainerdContainer{Id: shimId, SandboxName: "shim-pod", Type: "container", Snapshot: 4})
+	h.AddContainerdContainer(fakehost.ContainerdContainer{Id: cgroupfsId, SandboxName: "cgroupfs-pod", Type: "container", Snapshot: 6})
+	h.AddCrioContainer(crioId, "crio-pod", nil)
+
+	h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}})
+	h.AddProcess(fakehost.Process{Pid: 2, Comm: "kthreadd"})
+	h.AddProcess(fakehost.Process{Pid: 3, PPid: 2, Comm: "rcu_gp"})
+	// plain docker, cgroup v1
+	h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Cmdline: []string{"nginx"},
+		Cgroup: "11:memory:/docker/" + dockerId + "\n1:name=systemd:/docker/" + dockerId + "\n0::/"})
+	// cgroupfs driver, the runtime is found by its state, not the node
+	// default
+	h.AddProcess(fakehost.Process{Pid: 110, PPid: 1, Cmdline: []string{"envoy"},
+		Cgroup: "4:cpu,cpuacct:/kubepods/besteffort/pod1234/" + cgroupfsId + "\n11:memory:/kubepods/besteffort/pod1234/" + cgroupfsId})
+	// systemd driver, cgroup v2, below a sub-cgroup of the container
+	h.AddProcess(fakehost.Process{Pid: 200, PPid: 1, Cmdline: []string{"redis-server"},
+		Cgroup: "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod5678.slice/cri-containerd-" + containerdId + ".scope/init"})
+	// cri-o, seen from the agent's own cgroup namespace
+	h.AddProcess(fakehost.Process{Pid: 300, PPid: 1, Cmdline: []string{"postgres"},
+		Cgroup: "0::/../../kubepods-besteffort.slice/kubepods-besteffort-pod9abc.slice/crio-" + crioId + ".scope"})
+	h.AddProcess(fakehost.Process{Pid: 301, PPid: 1, Cmdline: []string{"conmon"},
+		Cgroup: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod9abc.slice/crio-conmon-" + crioId + ".scope"})
+	// no state file, still the container, without a pod
+	h.AddProcess(fakehost.Process{Pid: 310, PPid: 1, Cmdline: []string{"worker"},
+		Cgroup: "0::/system.slice/docker-" + goneId + ".scope"})
+	// no container cgroup, found through the shim
+	h.AddProcess(fakehost.Process{Pid: 400, PPid: 1, Cmdline: []string{"/usr/bin/containerd-shim-runc-v2", "-namespace", "k8s.io", "-id", shimId, "-address", "/run/containerd/containerd.sock"}})
+	h.AddProcess(fakehost.Process{Pid: 401, PPid: 400, Cmdline: []string{"/pause"}})
+	h.AddProcess(fakehost.Process{Pid: 402, PPid: 401, Cmdline: []string{"sh", "-c", "sleep infinity"}})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pidMap, err := GetPidMapper(procs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refMap, methodMap, runtimeMap, err := GetContainerId(procs, pidMap, "docker", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for pid, ref := range refMap {
+		line := fmt.Sprintf("%d\t%s\t%s\t%s", pid, ref, methodMap[pid], runtimeMap[ref.ContainerId])
+		lines = append(lines, strings.TrimSuffix(line, "\t"))
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		var a, b int
+		fmt.Sscan(lines[i], &a)
+		fmt.Sscan(lines[j], &b)
+		return a < b
+	})
+
+	assertGolden(t, "container_id", strings.Join(lines, "\n")+"\n")
+}
+
+func TestGetFileSystemDir(t *testing.T) {
+	for _, runtime := range []string{"docker", "containerd", "crio"} {
+		t.Run(runtime, func(t *testing.T) {
+			h := newHost(t)
+
+			var ids []string
+			for i, c := range []byte{'a', 'b'} {
+				id := containerIdOf(c)
+				ids = append(ids, id)
+				switch runtime {
+				case "docker":
+					h.AddDockerContainer(id, "pod", nil)
+				case "crio":
+					h.AddCrioContainer(id, "pod", nil)
+				case "containerd":
+					sandboxId := containerIdOf('0' + byte(i))
+					h.AddContainerdContainer(fakehost.ContainerdContainer{Id: sandboxId, SandboxId: sandboxId, Type: "sandbox", Snapshot: 10*i + 1})
+					h.AddContainerdContainer(fakehost.ContainerdContainer{Id: id, SandboxId: sandboxId, Type: "container", Snapshot: 10*i + 2})
+				}
+			}
+
+			runtimeMap := make(map[string]string)
+			for _, id := range ids {
+				runtimeMap[id] = runtime
+			}
+			diffList, err := GetFileSystemDir(ids, nil, runtimeMap, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(diffList)
+
+			got := strings.ReplaceAll(strings.Join(diffList, "\n"), h.Root, "$ROOT") + "\n"
+			assertGolden(t, "filesystem_dir_"+runtime, got)
+		})
+	}
+}
+
+func TestGetFileSystemDirBadState(t *testing.T) {
+	h := newHost(t)
+
+	okId, outsideId, brokenId := containerIdOf('a'), containerIdOf('b'), containerIdOf('c')
+	h.AddDockerContainer(okId, "pod", nil)
+	h.WriteJson("moby/"+outsideId+"/state.json", map[string]interface{}{
+		"config": map[string]interface{}{"rootfs": "/mnt/rootfs/" + outsideId + "/merged"},
+	})
+	h.WriteFile("moby/"+brokenId+"/state.json", "{")
+
+	ids := []string{outsideId, brokenId, okId}
+	runtimeMap := map[string]string{outsideId: "docker", brokenId: "docker", okId: "docker"}
+	diffList, err := GetFileSystemDir(ids, nil, runtimeMap, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"", "", h.Path("docker/overlay2/" + okId + "/diff")}
+	if !reflect.DeepEqual(diffList, want) {
+		t.Errorf("got %q, want %q", diffList, want)
+	}
+}
+
+func TestGetPodInfo(t *testing.T) {
+	h := newHost(t)
+
+	h.AddFiles("diff/a", []string{"etc/passwd", "tmp/", "usr/local/bin/miner"})
+	h.Symlink("/usr/local/bin", "diff/a/bin")
+	h.AddFiles("diff/b", []string{"root/.bash_history"})
+
+	refs := []ContainerRef{podRef("pod-a", containerIdOf('a')), podRef("pod-b", containerIdOf('b'))}
+	podInfo, err := GetPodInfo(refs, []string{h.Path("diff/a"), h.Path("diff/b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mergedList []MergedList
+	if err := json.Unmarshal([]byte(podInfo), &mergedList); err != nil {
+		t.Fatal(err)
+	}
+	// One entry per container, in the order of refs.
+	var gotRefs []ContainerRef
+	for _, merged := range mergedList {
+		gotRefs = append(gotRefs, merged.ContainerRef)
+	}
+	if !reflect.DeepEqual(gotRefs, refs) {
+		t.Errorf("got %+v, want %+v", gotRefs, refs)
+	}
+	assertGolden(t, "pod_info", podInfo+"\n")
+}
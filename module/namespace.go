@@ -0,0 +1,140 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// NamespaceInfo is a namespace and the processes living in it. IsHost
+// tells whether it is the namespace of PID 1 on the host.
+type NamespaceInfo struct {
+	Type       string         `json:"Type"`
+	Inode      uint64         `json:"Inode"`
+	IsHost     bool           `json:"IsHost"`
+	Containers []ContainerRef `json:"Containers"`
+	ProcessIds []string       `json:"ProcessIds"`
+}
+
+// ContainerNamespaces tells which namespaces a container shares with the
+// host. HostMountProcessIds are processes attributed to the container that
+// live in the host's mount namespace, which a container process never
+// should: it's how an escaped process looks like.
+type ContainerNamespaces struct {
+	HostPID             bool     `json:"HostPID"`
+	HostNetwork         bool     `json:"HostNetwork"`
+	HostIPC             bool     `json:"HostIPC"`
+	SharedWithHost      []string `json:"SharedWithHost"`
+	HostMountProcessIds []string `json:"HostMountProcessIds"`
+}
+
+// getHostNamespaces returns the namespaces of PID 1, or nil if it can't be
+// read.
+func getHostNamespaces(procs []procfs.Proc) map[string]uint64 {
+	for _, proc := range procs {
+		if proc.Pid == 1 {
+			return proc.Namespaces
+		}
+	}
+	return nil
+}
+
+func isHostNamespace(hostNamespaces map[string]uint64, nsType string, inode uint64) bool {
+	hostInode, ok := hostNamespaces[nsType]
+	return ok && inode != 0 && hostInode == inode
+}
+
+// GetContainerNamespaces compares the namespaces of a container's
+// processes with those of the host. A namespace counts as shared as soon as
+// one process of the container is in the host's.
+func GetContainerNamespaces(procs []procfs.Proc, hostNamespaces map[string]uint64) ContainerNamespaces {
+	containerNamespaces := ContainerNamespaces{
+		SharedWithHost:      make([]string, 0),
+		HostMountProcessIds: make([]string, 0),
+	}
+
+	shared := make(map[string]bool)
+	for _, proc := range procs {
+		for nsType, inode := range proc.Namespaces {
+			if isHostNamespace(hostNamespaces, nsType, inode) {
+				shared[nsType] = true
+			}
+		}
+		if isHostNamespace(hostNamespaces, "mnt", proc.Namespaces["mnt"]) {
+			containerNamespaces.HostMountProcessIds = append(containerNamespaces.HostMountProcessIds, strconv.Itoa(proc.Pid))
+		}
+	}
+
+	for _, nsType := range procfs.NamespaceTypes {
+		if shared[nsType] {
+			containerNamespaces.SharedWithHost = append(containerNamespaces.SharedWithHost, nsType)
+		}
+	}
+	containerNamespaces.HostPID = shared["pid"]
+	containerNamespaces.HostNetwork = shared["net"]
+	containerNamespaces.HostIPC = shared["ipc"]
+
+	return containerNamespaces
+}
+
+// GetNamespaceInfo groups the processes by namespace, host namespaces
+// first.
+func GetNamespaceInfo(procs []procfs.Proc, refMap map[int]ContainerRef) (string, error) {
+	hostNamespaces := getHostNamespaces(procs)
+	namespaces := make(map[string]*NamespaceInfo)
+	containers := make(map[string]map[ContainerRef]bool)
+
+	for _, proc := range procs {
+		ref, ok := refMap[proc.Pid]
+		for nsType, inode := range proc.Namespaces {
+			key := nsType + ":" + strconv.FormatUint(inode, 10)
+			namespace, seen := namespaces[key]
+			if !seen {
+				namespace = &NamespaceInfo{
+					Type:       nsType,
+					Inode:      inode,
+					IsHost:     isHostNamespace(hostNamespaces, nsType, inode),
+					Containers: make([]ContainerRef, 0),
+				}
+				namespaces[key] = namespace
+				containers[key] = make(map[ContainerRef]bool)
+			}
+			namespace.ProcessIds = append(namespace.ProcessIds, strconv.Itoa(proc.Pid))
+			if ok && !containers[key][ref] {
+				containers[key][ref] = true
+				namespace.Containers = append(namespace.Containers, ref)
+			}
+		}
+	}
+
+	namespaceInfo := make([]*NamespaceInfo, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		sort.Slice(namespace.Containers, func(i, j int) bool {
+			return namespace.Containers[i].String() < namespace.Containers[j].String()
+		})
+		namespaceInfo = append(namespaceInfo, namespace)
+	}
+
+	typeOrder := make(map[string]int, len(procfs.NamespaceTypes))
+	for i, nsType := range procfs.NamespaceTypes {
+		typeOrder[nsType] = i
+	}
+	sort.Slice(namespaceInfo, func(i, j int) bool {
+		a, b := namespaceInfo[i], namespaceInfo[j]
+		if a.Type != b.Type {
+			return typeOrder[a.Type] < typeOrder[b.Type]
+		}
+		if a.IsHost != b.IsHost {
+			return a.IsHost
+		}
+		return a.Inode < b.Inode
+	})
+
+	jsonData, err := json.MarshalIndent(namespaceInfo, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
@@ -0,0 +1,35 @@
+package module
+
+import (
+	"reflect"
+	"testing"
+
+	"container-agent/fakehost"
+)
+
+func TestGetContainerNamespaces(t *testing.T) {
+	h := newHost(t)
+
+	host := map[string]uint64{"pid": 1, "net": 2, "mnt": 3, "ipc": 4}
+	container := map[string]uint64{"pid": 11, "net": 2, "mnt": 13, "ipc": 14}
+	escaped := map[string]uint64{"pid": 11, "net": 2, "mnt": 3, "ipc": 14}
+
+	h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}, Namespaces: host})
+	h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Cmdline: []string{"nginx"}, Namespaces: container})
+	h.AddProcess(fakehost.Process{Pid: 101, PPid: 100, Cmdline: []string{"sh"}, Namespaces: escaped})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := GetContainerNamespaces(procs[1:], getHostNamespaces(procs))
+	want := ContainerNamespaces{
+		HostNetwork:         true,
+		SharedWithHost:      []string{"net", "mnt"},
+		HostMountProcessIds: []string{"101"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,310 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// NodeCpu is the share of time a CPU (or all of them, for "cpu") spent in
+// each state over the last collection interval.
+type NodeCpu struct {
+	Name    string `json:"Name"`
+	User    string `json:"User"`
+	Nice    string `json:"Nice"`
+	System  string `json:"System"`
+	Idle    string `json:"Idle"`
+	IOWait  string `json:"IOWait"`
+	IRQ     string `json:"IRQ"`
+	SoftIRQ string `json:"SoftIRQ"`
+	Steal   string `json:"Steal"`
+}
+
+// NodeMemory is the part of /proc/meminfo worth watching. Usage is the
+// share of MemTotal that is not MemAvailable.
+type NodeMemory struct {
+	Total     string `json:"Total"`
+	Free      string `json:"Free"`
+	Available string `json:"Available"`
+	Buffers   string `json:"Buffers"`
+	Cached    string `json:"Cached"`
+	Shmem     string `json:"Shmem"`
+	Slab      string `json:"Slab"`
+	Dirty     string `json:"Dirty"`
+	SwapTotal string `json:"SwapTotal"`
+	SwapFree  string `json:"SwapFree"`
+	Usage     string `json:"Usage"`
+}
+
+type NodeLoad struct {
+	Load1            string `json:"Load1"`
+	Load5            string `json:"Load5"`
+	Load15           string `json:"Load15"`
+	RunningProcesses int    `json:"RunningProcesses"`
+	TotalProcesses   int    `json:"TotalProcesses"`
+}
+
+// NodeDisk is the activity of a block device over the last collection
+// interval. Utilization is the share of time it had I/O in flight.
+type NodeDisk struct {
+	Name        string `json:"Name"`
+	Read        string `json:"Read"`
+	Write       string `json:"Write"`
+	ReadIops    string `json:"ReadIops"`
+	WriteIops   string `json:"WriteIops"`
+	Utilization string `json:"Utilization"`
+}
+
+// NodeNetwork is the traffic of a host interface over the last collection
+// interval. Errors and drops are totals since boot.
+type NodeNetwork struct {
+	Name      string `json:"Name"`
+	Receive   string `json:"Receive"`
+	Transmit  string `json:"Transmit"`
+	RxPackets string `json:"RxPackets"`
+	TxPackets string `json:"TxPackets"`
+	RxErrors  uint64 `json:"RxErrors"`
+	TxErrors  uint64 `json:"TxErrors"`
+	RxDropped uint64 `json:"RxDropped"`
+	TxDropped uint64 `json:"TxDropped"`
+}
+
+// NodePressure is the pressure stall information of a resource, in percent
+// of the time over 10, 60 and 300 seconds.
+type NodePressure struct {
+	Resource   string `json:"Resource"`
+	SomeAvg10  string `json:"SomeAvg10"`
+	SomeAvg60  string `json:"SomeAvg60"`
+	SomeAvg300 string `json:"SomeAvg300"`
+	FullAvg10  string `json:"FullAvg10"`
+	FullAvg60  string `json:"FullAvg60"`
+	FullAvg300 string `json:"FullAvg300"`
+}
+
+// NodeInfo is the node as a whole. Sections whose /proc files can't be read
+// (e.g. no PSI before Linux 4.20) are left empty.
+type NodeInfo struct {
+	Cpus     []NodeCpu      `json:"Cpus"`
+	Memory   NodeMemory     `json:"Memory"`
+	Load     NodeLoad       `json:"Load"`
+	Disks    []NodeDisk     `json:"Disks"`
+	Networks []NodeNetwork  `json:"Networks"`
+	Pressure []NodePressure `json:"Pressure"`
+}
+
+// nodeSample is the counters of the previous GetNodeInfo run, see
+// cpuSample.
+type nodeSample struct {
+	uptime  float64
+	cpus    map[string]procfs.CpuTimes
+	disks   map[string]procfs.DiskStat
+	netDevs map[string]procfs.NetDev
+}
+
+// prevNodeSample is only touched by GetNodeInfo, which runs from the
+// singleton Monitoring() job.
+var prevNodeSample nodeSample
+
+func formatShare(part uint64, total uint64) string {
+	if total == 0 {
+		return fmt.Sprintf("%.3f%%", 0.0)
+	}
+	return fmt.Sprintf("%.3f%%", 100.0*(float64)(part)/(float64)(total))
+}
+
+// counterDelta returns now-prev, or now if the counter went backwards
+// (e.g. a device was replaced).
+func counterDelta(now uint64, prev uint64) uint64 {
+	if now < prev {
+		return now
+	}
+	return now - prev
+}
+
+func getNodeCpus(cpus []procfs.CpuTimes, prevCpus map[string]procfs.CpuTimes) []NodeCpu {
+	nodeCpus := make([]NodeCpu, 0, len(cpus))
+
+	for _, cpu := range cpus {
+		prev := prevCpus[cpu.Name]
+		delta := procfs.CpuTimes{
+			User:    counterDelta(cpu.User, prev.User),
+			Nice:    counterDelta(cpu.Nice, prev.Nice),
+			System:  counterDelta(cpu.System, prev.System),
+			Idle:    counterDelta(cpu.Idle, prev.Idle),
+			IOWait:  counterDelta(cpu.IOWait, prev.IOWait),
+			IRQ:     counterDelta(cpu.IRQ, prev.IRQ),
+			SoftIRQ: counterDelta(cpu.SoftIRQ, prev.SoftIRQ),
+			Steal:   counterDelta(cpu.Steal, prev.Steal),
+		}
+		total := delta.Total()
+		nodeCpus = append(nodeCpus, NodeCpu{
+			Name:    cpu.Name,
+			User:    formatShare(delta.User, total),
+			Nice:    formatShare(delta.Nice, total),
+			System:  formatShare(delta.System, total),
+			Idle:    formatShare(delta.Idle, total),
+			IOWait:  formatShare(delta.IOWait, total),
+			IRQ:     formatShare(delta.IRQ, total),
+			SoftIRQ: formatShare(delta.SoftIRQ, total),
+			Steal:   formatShare(delta.Steal, total),
+		})
+	}
+
+	return nodeCpus
+}
+
+func getNodeMemory(meminfo map[string]uint64) NodeMemory {
+	var usage string
+	if total := meminfo["MemTotal"]; total > 0 && meminfo["MemAvailable"] <= total {
+		usage = formatShare(total-meminfo["MemAvailable"], total)
+	}
+
+	return NodeMemory{
+		Total:     formatMB(meminfo["MemTotal"]),
+		Free:      formatMB(meminfo["MemFree"]),
+		Available: formatMB(meminfo["MemAvailable"]),
+		Buffers:   formatMB(meminfo["Buffers"]),
+		Cached:    formatMB(meminfo["Cached"]),
+		Shmem:     formatMB(meminfo["Shmem"]),
+		Slab:      formatMB(meminfo["Slab"]),
+		Dirty:     formatMB(meminfo["Dirty"]),
+		SwapTotal: formatMB(meminfo["SwapTotal"]),
+		SwapFree:  formatMB(meminfo["SwapFree"]),
+		Usage:     usage,
+	}
+}
+
+// isVirtualDisk tells the devices that never hold a filesystem the node
+// uses on their own: unused loop devices and ramdisks.
+func isVirtualDisk(diskStat procfs.DiskStat) bool {
+	if strings.HasPrefix(diskStat.Name, "ram") {
+		return true
+	}
+	return strings.HasPrefix(diskStat.Name, "loop") && diskStat.ReadsCompleted == 0 && diskStat.WritesCompleted == 0
+}
+
+// GetNodeInfo reads the node-wide counters. Like GetCpuUsage it measures
+// rates over the interval since the previous run, or since boot on the
+// first one.
+func GetNodeInfo(uptime float64) (string, error) {
+	nodeInfo := NodeInfo{
+		Cpus:     make([]NodeCpu, 0),
+		Disks:    make([]NodeDisk, 0),
+		Networks: make([]NodeNetwork, 0),
+		Pressure: make([]NodePressure, 0),
+	}
+	sample := nodeSample{
+		uptime:  uptime,
+		cpus:    make(map[string]procfs.CpuTimes),
+		disks:   make(map[string]procfs.DiskStat),
+		netDevs: make(map[string]procfs.NetDev),
+	}
+
+	seconds := uptime
+	if prevNodeSample.uptime > 0 && uptime > prevNodeSample.uptime {
+		seconds = uptime - prevNodeSample.uptime
+	} else {
+		prevNodeSample = nodeSample{}
+	}
+
+	if kernelStat, err := procFS.KernelStat(); err == nil {
+		cpus := append([]procfs.CpuTimes{kernelStat.Cpu}, kernelStat.Cpus...)
+		for _, cpu := range cpus {
+			sample.cpus[cpu.Name] = cpu
+		}
+		nodeInfo.Cpus = getNodeCpus(cpus, prevNodeSample.cpus)
+	}
+
+	if meminfo, err := procFS.Meminfo(); err == nil {
+		nodeInfo.Memory = getNodeMemory(meminfo)
+	}
+
+	if loadAvg, err := procFS.LoadAvg(); err == nil {
+		nodeInfo.Load = NodeLoad{
+			Load1:            fmt.Sprintf("%.2f", loadAvg.Load1),
+			Load5:            fmt.Sprintf("%.2f", loadAvg.Load5),
+			Load15:           fmt.Sprintf("%.2f", loadAvg.Load15),
+			RunningProcesses: loadAvg.Running,
+			TotalProcesses:   loadAvg.Total,
+		}
+	}
+
+	if diskStats, err := procFS.DiskStats(); err == nil {
+		for _, diskStat := range diskStats {
+			if isVirtualDisk(diskStat) {
+				continue
+			}
+			sample.disks[diskStat.Name] = diskStat
+			prev := prevNodeSample.disks[diskStat.Name]
+			ioTime := (float64)(counterDelta(diskStat.IoTime, prev.IoTime)) / 1000
+			nodeInfo.Disks = append(nodeInfo.Disks, NodeDisk{
+				Name:        diskStat.Name,
+				Read:        formatByteRate((float64)(counterDelta(diskStat.SectorsRead, prev.SectorsRead)*512) / seconds),
+				Write:       formatByteRate((float64)(counterDelta(diskStat.SectorsWritten, prev.SectorsWritten)*512) / seconds),
+				ReadIops:    formatRate((float64)(counterDelta(diskStat.ReadsCompleted, prev.ReadsCompleted)) / seconds),
+				WriteIops:   formatRate((float64)(counterDelta(diskStat.WritesCompleted, prev.WritesCompleted)) / seconds),
+				Utilization: fmt.Sprintf("%.3f%%", 100.0*ioTime/seconds),
+			})
+		}
+	}
+
+	if netDevs, err := procFS.NetDev(1); err == nil {
+		for _, netDev := range netDevs {
+			sample.netDevs[netDev.Name] = netDev
+			prev := prevNodeSample.netDevs[netDev.Name]
+			nodeInfo.Networks = append(nodeInfo.Networks, NodeNetwork{
+				Name:      netDev.Name,
+				Receive:   formatByteRate((float64)(counterDelta(netDev.RxBytes, prev.RxBytes)) / seconds),
+				Transmit:  formatByteRate((float64)(counterDelta(netDev.TxBytes, prev.TxBytes)) / seconds),
+				RxPackets: formatRate((float64)(counterDelta(netDev.RxPackets, prev.RxPackets)) / seconds),
+				TxPackets: formatRate((float64)(counterDelta(netDev.TxPackets, prev.TxPackets)) / seconds),
+				RxErrors:  netDev.RxErrs,
+				TxErrors:  netDev.TxErrs,
+				RxDropped: netDev.RxDrop,
+				TxDropped: netDev.TxDrop,
+			})
+		}
+		sort.Slice(nodeInfo.Networks, func(i, j int) bool {
+			return nodeInfo.Networks[i].Name < nodeInfo.Networks[j].Name
+		})
+	}
+
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		pressure, err := procFS.Pressure(resource)
+		if err != nil {
+			continue
+		}
+		nodeInfo.Pressure = append(nodeInfo.Pressure, NodePressure{
+			Resource:   resource,
+			SomeAvg10:  fmt.Sprintf("%.2f%%", pressure.Some.Avg10),
+			SomeAvg60:  fmt.Sprintf("%.2f%%", pressure.Some.Avg60),
+			SomeAvg300: fmt.Sprintf("%.2f%%", pressure.Some.Avg300),
+			FullAvg10:  fmt.Sprintf("%.2f%%", pressure.Full.Avg10),
+			FullAvg60:  fmt.Sprintf("%.2f%%", pressure.Full.Avg60),
+			FullAvg300: fmt.Sprintf("%.2f%%", pressure.Full.Avg300),
+		})
+	}
+	prevNodeSample = sample
+
+	jsonData, err := json.MarshalIndent(nodeInfo, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
+
+// ReadNodeInfo returns the node info the last Monitoring() run wrote.
+func ReadNodeInfo() (NodeInfo, error) {
+	var nodeInfo NodeInfo
+
+	content, err := ioutil.ReadFile(outputDir + "/node")
+	if err != nil {
+		return nodeInfo, err
+	}
+	err = json.Unmarshal(content, &nodeInfo)
+	return nodeInfo, err
+}
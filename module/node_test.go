@@ -0,0 +1,50 @@
+package module
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetNodeInfo(t *testing.T) {
+	h := newHost(t)
+	prevNodeSample = nodeSample{}
+	t.Cleanup(func() { prevNodeSample = nodeSample{} })
+
+	h.WriteFile("proc/meminfo", "MemTotal:       1048576 kB\nMemFree:         262144 kB\nMemAvailable:    524288 kB\nHugePages_Total:       0\n")
+	h.WriteFile("proc/loadavg", "0.50 0.25 0.10 2/300 4242\n")
+	h.WriteFile("proc/diskstats", "   7       0 loop0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n 259       0 nvme0n1 100 0 2000 50 200 0 4000 80 0 500 130 0 0 0 0 0 0\n")
+	h.WriteFile("proc/1/net/dev", "Inter-|   Receive                                                |  Transmit\n face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n  eth0: 1024000 1000 1 2 0 0 0 0 2048000 2000 3 4 0 0 0 0\n")
+	h.WriteFile("proc/pressure/io", "some avg10=1.50 avg60=0.75 avg300=0.25 total=12345\nfull avg10=0.50 avg60=0.25 avg300=0.10 total=6789\n")
+
+	if _, err := GetNodeInfo(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10 seconds later: cpu0 was busy for half of it, 1MB read from disk.
+	h.WriteFile("proc/stat", "cpu  600 0 100 1500 0 0 0 0 0 0\ncpu0 550 0 50 500 0 0 0 0 0 0\ncpu1 50 0 50 1000 0 0 0 0 0 0\nbtime 1600000000\n")
+	h.WriteFile("proc/diskstats", " 259       0 nvme0n1 356 0 4048 50 200 0 4000 80 0 2500 130 0 0 0 0 0 0\n")
+	nodeInfoJson, err := GetNodeInfo(1010)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nodeInfo NodeInfo
+	if err := json.Unmarshal([]byte(nodeInfoJson), &nodeInfo); err != nil {
+		t.Fatal(err)
+	}
+	if len(nodeInfo.Cpus) != 3 || nodeInfo.Cpus[0].User != "50.000%" || nodeInfo.Cpus[1].User != "100.000%" || nodeInfo.Cpus[2].Idle != "100.000%" {
+		t.Errorf("unexpected cpus %+v", nodeInfo.Cpus)
+	}
+	if nodeInfo.Memory.Usage != "50.000%" || nodeInfo.Load.Load1 != "0.50" || nodeInfo.Load.TotalProcesses != 300 {
+		t.Errorf("unexpected memory or load %+v %+v", nodeInfo.Memory, nodeInfo.Load)
+	}
+	if len(nodeInfo.Disks) != 1 || nodeInfo.Disks[0].Read != "102.4KB/s" || nodeInfo.Disks[0].ReadIops != "25.6/s" || nodeInfo.Disks[0].Utilization != "20.000%" {
+		t.Errorf("unexpected disks %+v", nodeInfo.Disks)
+	}
+	if len(nodeInfo.Networks) != 1 || nodeInfo.Networks[0].Name != "eth0" || nodeInfo.Networks[0].Receive != "0.0KB/s" || nodeInfo.Networks[0].TxDropped != 4 {
+		t.Errorf("unexpected networks %+v", nodeInfo.Networks)
+	}
+	if len(nodeInfo.Pressure) != 1 || nodeInfo.Pressure[0].Resource != "io" || nodeInfo.Pressure[0].SomeAvg10 != "1.50%" {
+		t.Errorf("unexpected pressure %+v", nodeInfo.Pressure)
+	}
+}
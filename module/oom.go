@@ -0,0 +1,264 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Event types of the OOM killer and of processes stuck in a state.
+const (
+	EventOomKill         = "oom-kill"
+	EventZombie          = "zombie"
+	EventUninterruptible = "uninterruptible"
+)
+
+// Where OOM kills are seen.
+const (
+	EventSourceCgroup = "cgroup"
+	EventSourceKmsg   = "kmsg"
+)
+
+// stuckPolls is the number of consecutive Monitoring() runs a process must
+// be seen in Z or D state to count as stuck. Both states are normal for a
+// moment: a zombie waits for its parent to reap it, D covers every disk
+// read.
+const stuckPolls = 2
+
+// prevOomKills, stuckProcesses and kmsg are only touched by
+// DetectOomKills and DetectStuckProcesses, which run from the singleton
+// Monitoring() job. prevOomKills is keyed by container ID.
+var (
+	prevOomKills   map[string]int64
+	stuckProcesses = map[processKey]stuckProcess{}
+	kmsg           *kmsgReader
+)
+
+type stuckProcess struct {
+	state string
+	polls int
+}
+
+// kmsgReader reads the kernel log from /dev/kmsg without blocking. Every
+// read returns a single record.
+type kmsgReader struct {
+	fd  int
+	buf []byte
+}
+
+// openKmsg opens the kernel log and skips what was logged before. Reading
+// it needs CAP_SYSLOG unless kernel.dmesg_restrict is 0.
+func openKmsg(path string) (*kmsgReader, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := syscall.Seek(fd, 0, 2); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	return &kmsgReader{fd: fd, buf: make([]byte, 8192)}, nil
+}
+
+// readAll returns the messages logged since the previous call.
+func (r *kmsgReader) readAll() []string {
+	var messages []string
+	for {
+		n, err := syscall.Read(r.fd, r.buf)
+		if err == syscall.EPIPE {
+			// Records were overwritten before we read them, the next read
+			// continues with the oldest one left.
+			continue
+		}
+		if err != nil || n <= 0 {
+			return messages
+		}
+		// "<prio>,<seq>,<usec>,<flags>[,...];<message>\n"
+		record := string(r.buf[:n])
+		if semicolon := strings.IndexByte(record, ';'); semicolon >= 0 {
+			record = record[semicolon+1:]
+		}
+		messages = append(messages, strings.TrimSuffix(strings.SplitN(record, "\n", 2)[0], "\n"))
+	}
+}
+
+// kmsgOomKill is an OOM kill as logged by the kernel. The
+// "oom-kill:constraint=...,task_memcg=<path>,task=<comm>,pid=<pid>,..."
+// summary line (Linux 4.19) carries the cgroup, "Killed process <pid>
+// (<comm>)" is logged by every kernel.
+type kmsgOomKill struct {
+	pid        int
+	comm       string
+	cgroupPath string
+	message    string
+}
+
+var kmsgKilledProcess = regexp.MustCompile(`Killed process (\d+) \((.*?)\)`)
+
+// parseKmsgOomKill parses a kernel log message, returning false if it is
+// not about an OOM kill.
+func parseKmsgOomKill(message string) (kmsgOomKill, bool) {
+	if strings.HasPrefix(message, "oom-kill:") {
+		oomKill := kmsgOomKill{message: message}
+		for _, field := range strings.Split(strings.TrimPrefix(message, "oom-kill:"), ",") {
+			key, value, _ := strings.Cut(field, "=")
+			switch key {
+			case "task_memcg":
+				oomKill.cgroupPath = value
+			case "task":
+				oomKill.comm = value
+			case "pid":
+				oomKill.pid, _ = strconv.Atoi(value)
+			}
+		}
+		return oomKill, oomKill.pid != 0
+	}
+	if match := kmsgKilledProcess.FindStringSubmatch(message); match != nil {
+		pid, _ := strconv.Atoi(match[1])
+		return kmsgOomKill{pid: pid, comm: match[2], message: message}, true
+	}
+	return kmsgOomKill{}, false
+}
+
+// containerRefs maps the container IDs of refMap to their ContainerRef.
+func containerRefs(refMap map[int]ContainerRef) map[string]ContainerRef {
+	refs := make(map[string]ContainerRef)
+	for _, ref := range refMap {
+		if !ref.IsHost() {
+			refs[ref.ContainerId] = ref
+		}
+	}
+	return refs
+}
+
+// DetectOomKills reports OOM kills as events. The oom_kill counter of each
+// container's memory cgroup is compared with the previous run, or with 0
+// for a container that started since, so a kill before it was first seen
+// is not missed. Kills the counters can't account for, in
+// containers without a readable counter (old kernels, or the cgroup is
+// gone as the container died), and on the host, are taken from /dev/kmsg
+// when it can be read.
+func DetectOomKills(procs []procfs.Proc, refMap map[int]ContainerRef, now time.Time) {
+	oomKills := make(map[string]int64)
+	var counted []ContainerRef
+
+	for _, proc := range procs {
+		ref := refMap[proc.Pid]
+		if ref.IsHost() {
+			continue
+		}
+		if _, ok := oomKills[ref.ContainerId]; ok {
+			continue
+		}
+		// Kernel threads and zombies have no cgroup, other processes of the
+		// container may.
+		count, err := GetOomKills(proc.Cgroups)
+		if err != nil {
+			continue
+		}
+		oomKills[ref.ContainerId] = count
+		counted = append(counted, ref)
+	}
+
+	if kmsg == nil {
+		kmsg, _ = openKmsg(hostRoot + "/dev/kmsg")
+	}
+	var kmsgMessages []string
+	if kmsg != nil {
+		kmsgMessages = kmsg.readAll()
+	}
+
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	loadProcessEvents()
+
+	if prevOomKills != nil {
+		for _, ref := range counted {
+			prev := prevOomKills[ref.ContainerId]
+			if oomKills[ref.ContainerId] <= prev {
+				continue
+			}
+			event := newProcessEvent(EventOomKill, EventSourceCgroup, processKey{}, processSnapshot{ref: ref}, now)
+			event.ProcessId = ""
+			event.ParentId = ""
+			event.Uid = ""
+			event.Message = fmt.Sprintf("oom_kill: %d -> %d", prev, oomKills[ref.ContainerId])
+			processEvents = append(processEvents, event)
+		}
+	}
+	prevOomKills = oomKills
+
+	// Each kill is logged twice, see kmsgOomKill.
+	refs := containerRefs(refMap)
+	killedPids := make(map[int]bool)
+	for _, message := range kmsgMessages {
+		oomKill, ok := parseKmsgOomKill(message)
+		if !ok || killedPids[oomKill.pid] {
+			continue
+		}
+		killedPids[oomKill.pid] = true
+		ref, attributed := refMap[oomKill.pid]
+		if containerId, _ := parseContainerCgroupPath(oomKill.cgroupPath); containerId != "" {
+			ref, attributed = refs[containerId]
+			if !attributed {
+				ref = ContainerRef{ContainerId: containerId}
+			}
+		} else if !attributed && oomKill.cgroupPath != "" {
+			ref = hostRef
+		}
+		if _, ok := oomKills[ref.ContainerId]; ok {
+			// Already reported through the counter.
+			continue
+		}
+		key, _ := findProcessKey(oomKill.pid)
+		snapshot, ok := prevProcesses[key]
+		if !ok {
+			snapshot = processSnapshot{comm: oomKill.comm}
+		}
+		snapshot.ref = ref
+		event := newProcessEvent(EventOomKill, EventSourceKmsg, processKey{oomKill.pid, key.startTime}, snapshot, now)
+		event.Message = oomKill.message
+		processEvents = append(processEvents, event)
+	}
+}
+
+// DetectStuckProcesses reports processes seen in Z or D state for
+// stuckPolls consecutive runs, once per process and state.
+func DetectStuckProcesses(procs []procfs.Proc, refMap map[int]ContainerRef, now time.Time) {
+	stuck := make(map[processKey]stuckProcess)
+
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	loadProcessEvents()
+
+	for _, proc := range procs {
+		state := proc.Stat.State
+		if state != "Z" && state != "D" {
+			continue
+		}
+		key := newProcessKey(proc)
+		entry := stuckProcesses[key]
+		if entry.state != state {
+			entry = stuckProcess{state: state}
+		}
+		entry.polls++
+		stuck[key] = entry
+
+		if entry.polls != stuckPolls {
+			continue
+		}
+		eventType := EventZombie
+		if state == "D" {
+			eventType = EventUninterruptible
+		}
+		event := newProcessEvent(eventType, EventSourcePoll, key, newProcessSnapshot(proc, refMap[proc.Pid]), now)
+		event.Message = fmt.Sprintf("State %s for %d runs", state, stuckPolls)
+		processEvents = append(processEvents, event)
+	}
+
+	stuckProcesses = stuck
+}
@@ -0,0 +1,89 @@
+package module
+
+import (
+	"testing"
+	"time"
+
+	"container-agent/fakehost"
+	"container-agent/procfs"
+)
+
+func TestParseKmsgOomKill(t *testing.T) {
+	id := containerIdOf('a')
+
+	oomKill, ok := parseKmsgOomKill("oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=" + id + ",mems_allowed=0,oom_memcg=/kubepods/burstable/pod1/" + id + ",task_memcg=/kubepods/burstable/pod1/" + id + ",task=java,pid=4242,uid=1000")
+	if !ok || oomKill.pid != 4242 || oomKill.comm != "java" || oomKill.cgroupPath != "/kubepods/burstable/pod1/"+id {
+		t.Errorf("unexpected summary %+v", oomKill)
+	}
+
+	oomKill, ok = parseKmsgOomKill("Memory cgroup out of memory: Killed process 4242 (java) total-vm:4194304kB, anon-rss:1048576kB, file-rss:0kB")
+	if !ok || oomKill.pid != 4242 || oomKill.comm != "java" {
+		t.Errorf("unexpected kill %+v", oomKill)
+	}
+
+	if _, ok := parseKmsgOomKill("eth0: link up"); ok {
+		t.Error("expected no OOM kill")
+	}
+}
+
+func TestDetectOomKillsAndStuckProcesses(t *testing.T) {
+	h := newHost(t)
+	prevProcesses, prevPids, prevContainers, processEvents, nextEventId = nil, nil, nil, nil, 1
+	prevOomKills, stuckProcesses = nil, map[processKey]stuckProcess{}
+	t.Cleanup(func() {
+		prevProcesses, prevPids, prevContainers, processEvents, nextEventId = nil, nil, nil, nil, 1
+		prevOomKills, stuckProcesses = nil, map[processKey]stuckProcess{}
+	})
+
+	id := containerIdOf('a')
+	h.WriteFile("sys/fs/cgroup/cgroup.controllers", "cpu memory pids\n")
+	h.WriteFile("sys/fs/cgroup/kubepods/pod1/"+id+"/memory.events", "low 0\nhigh 0\nmax 12\noom 1\noom_kill 1\n")
+	h.AddProcess(fakehost.Process{Pid: 50, Cmdline: []string{"java"}, Cgroup: "0::/kubepods/pod1/" + id})
+	h.AddProcess(fakehost.Process{Pid: 51, PPid: 50, Comm: "worker", State: "D", Cgroup: "0::/kubepods/pod1/" + id})
+	h.AddProcess(fakehost.Process{Pid: 60, PPid: 1, Comm: "defunct", State: "Z"})
+	refMap := map[int]ContainerRef{50: podRef("web", id), 51: podRef("web", id), 60: hostRef}
+
+	run := func() {
+		procs, err := procFS.AllProcs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		DetectOomKills(procs, refMap, time.Now())
+		DetectStuckProcesses(procs, refMap, time.Now())
+	}
+
+	run()
+	if len(processEvents) != 0 {
+		t.Fatalf("unexpected events on the first run %+v", processEvents)
+	}
+
+	h.WriteFile("sys/fs/cgroup/kubepods/pod1/"+id+"/memory.events", "low 0\nhigh 0\nmax 20\noom 3\noom_kill 3\n")
+	// Started and killed between two runs.
+	newId := containerIdOf('b')
+	h.WriteFile("sys/fs/cgroup/kubepods/pod2/"+newId+"/memory.events", "low 0\nhigh 0\nmax 4\noom 1\noom_kill 1\n")
+	h.AddProcess(fakehost.Process{Pid: 70, Cmdline: []string{"node"}, Cgroup: "0::/kubepods/pod2/" + newId})
+	refMap[70] = podRef("api", newId)
+	run()
+	run()
+
+	want := []ProcessEvent{
+		{Type: EventOomKill, Source: EventSourceCgroup, ContainerRef: podRef("web", id), Message: "oom_kill: 1 -> 3"},
+		{Type: EventOomKill, Source: EventSourceCgroup, ContainerRef: podRef("api", newId), Message: "oom_kill: 0 -> 1"},
+		{Type: EventUninterruptible, Source: EventSourcePoll, ProcessId: "51", ProcessName: "worker", ContainerRef: podRef("web", id)},
+		{Type: EventZombie, Source: EventSourcePoll, ProcessId: "60", ProcessName: "defunct", ContainerRef: hostRef},
+	}
+	if len(processEvents) != len(want) {
+		t.Fatalf("got %+v, want %d events", processEvents, len(want))
+	}
+	for i, event := range processEvents {
+		if event.Type != want[i].Type || event.Source != want[i].Source || event.ProcessId != want[i].ProcessId || event.ProcessName != want[i].ProcessName ||
+			event.PodName != want[i].PodName || event.ContainerId != want[i].ContainerId || (want[i].Message != "" && event.Message != want[i].Message) {
+			t.Errorf("event %d: got %+v, want %+v", i, event, want[i])
+		}
+	}
+
+	stats, err := GetCgroupStats([]procfs.Cgroup{{Path: "/kubepods/pod1/" + id}})
+	if err != nil || stats.OomKills != 3 {
+		t.Errorf("got %d oom kills (%v), want 3", stats.OomKills, err)
+	}
+}
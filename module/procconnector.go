@@ -0,0 +1,167 @@
+package module
+
+import (
+	"container-agent/cnproc"
+	"container-agent/procfs"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// connectorFlushInterval is how often the events the connector collects are
+// written out for the /events endpoint, on top of every Monitoring() run.
+const connectorFlushInterval = 5 * time.Second
+
+// connectorEventsPending tells whether the connector added events since the
+// last flush. It is guarded by eventsMutex.
+var connectorEventsPending bool
+
+// connectorContainerRef attributes a process reported by the connector.
+// The cgroup is checked first like GetContainerId does; a process in no
+// container's cgroup inherits the attribution of its parent, which is how a
+// fresh fork looks before the runtime moved it. The caller holds
+// eventsMutex.
+func connectorContainerRef(proc procfs.Proc) ContainerRef {
+	containerId, runtime := GetContainerCgroup(proc.Cgroups)
+	if containerId == "" {
+		if key, ok := findProcessKey(proc.Stat.PPid); ok {
+			return prevProcesses[key].ref
+		}
+		return hostRef
+	}
+
+	if ref, ok := prevContainers[containerId]; ok {
+		return ref
+	}
+	return resolveContainerRef(containerId, runtime, RuntimeDocker, nil)
+}
+
+// findProcessKey looks up the known process with pid. The caller holds
+// eventsMutex.
+func findProcessKey(pid int) (processKey, bool) {
+	key, ok := prevPids[pid]
+	return key, ok
+}
+
+// handleConnectorEvent turns a connector event into a process event. The
+// process is read right away, while it still exists, and before taking
+// eventsMutex; if it is already gone the event carries what the connector
+// told. Threads are ignored.
+func handleConnectorEvent(event cnproc.Event, now time.Time) {
+	if event.IsThread() {
+		return
+	}
+
+	var proc procfs.Proc
+	var readErr error
+	if event.Type != cnproc.EventExit {
+		proc, readErr = readProcBasic(event.Pid)
+	}
+
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	if prevProcesses == nil {
+		// Nothing to compare with before the first Monitoring() run.
+		return
+	}
+
+	if event.Type == cnproc.EventExit {
+		key, ok := findProcessKey(event.Pid)
+		if !ok {
+			key = processKey{pid: event.Pid}
+		}
+		processEvents = append(processEvents, newProcessEvent(EventExited, EventSourceConnector, key, prevProcesses[key], now))
+		removePrevProcess(key)
+		connectorEventsPending = true
+		return
+	}
+
+	key := processKey{pid: event.Pid}
+	snapshot := processSnapshot{ppid: event.ParentTgid}
+	var cwd string
+	if readErr == nil {
+		key.startTime = proc.Stat.StartTime
+		snapshot = newProcessSnapshot(proc, connectorContainerRef(proc))
+		cwd = proc.Cwd
+	}
+
+	var processEvent ProcessEvent
+	prev, known := prevProcesses[key]
+	switch {
+	case event.Type == cnproc.EventFork && known:
+		// The poll got there first.
+		return
+	case event.Type == cnproc.EventFork:
+		processEvent = newProcessEvent(EventStarted, EventSourceConnector, key, snapshot, now)
+	default:
+		processEvent = newProcessEvent(EventExec, EventSourceConnector, key, snapshot, now)
+		if known {
+			processEvent.Changes = snapshotChanges(prev, snapshot)
+		}
+	}
+	processEvent.Cwd = cwd
+	processEvents = append(processEvents, processEvent)
+	connectorEventsPending = true
+
+	if key.startTime != 0 {
+		addPrevProcess(key, snapshot)
+	}
+}
+
+// flushProcessEvents writes the events for the /events endpoint if the
+// connector added any.
+func flushProcessEvents() error {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	if !connectorEventsPending {
+		return nil
+	}
+	connectorEventsPending = false
+
+	events, err := marshalProcessEvents()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputDir+"/events", []byte(events), 0644)
+}
+
+// RunProcConnector feeds the fork, exec and exit events of source into the
+// process events until source fails, so processes living shorter than a
+// Monitoring() interval show up too. It returns the error source failed
+// with.
+func RunProcConnector(source cnproc.Source) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(connectorFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := flushProcessEvents(); err != nil {
+					fmt.Println("proc connector:", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		events, err := source.Next()
+		if err == cnproc.ErrLost {
+			fmt.Println("proc connector:", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		for _, event := range events {
+			handleConnectorEvent(event, now)
+		}
+	}
+}
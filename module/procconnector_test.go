@@ -0,0 +1,109 @@
+package module
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"container-agent/cnproc"
+	"container-agent/fakehost"
+)
+
+// fakeSource replays batches of events, then fails with io.EOF.
+type fakeSource struct {
+	batches [][]cnproc.Event
+}
+
+func (s *fakeSource) Next() ([]cnproc.Event, error) {
+	if len(s.batches) == 0 {
+		return nil, io.EOF
+	}
+	events := s.batches[0]
+	s.batches = s.batches[1:]
+	return events, nil
+}
+
+func (s *fakeSource) Close() error {
+	return nil
+}
+
+func TestRunProcConnector(t *testing.T) {
+	h := newHost(t)
+	prevProcesses, prevPids, prevContainers, processEvents, nextEventId = nil, nil, nil, nil, 1
+	t.Cleanup(func() { prevProcesses, prevPids, prevContainers, processEvents, nextEventId = nil, nil, nil, nil, 1 })
+
+	id := containerIdOf('a')
+	h.AddDockerContainer(id, "web", nil)
+	h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}, StartTime: 1})
+	h.AddProcess(fakehost.Process{Pid: 50, PPid: 1, Cmdline: []string{"nginx"}, StartTime: 50, Cgroup: "0::/kubepods/pod1/" + id})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetProcessEvents(procs, map[int]ContainerRef{1: hostRef, 50: podRef("web", id)}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// nginx spawns a shell that runs a command and exits within the
+	// interval. pid 61 is gone before it could be read.
+	h.AddProcess(fakehost.Process{Pid: 60, PPid: 50, Cmdline: []string{"sh", "-c", "id"}, StartTime: 60, Uid: 33, Cwd: "/tmp"})
+	// A container started since, without state files to read yet.
+	newId := containerIdOf('b')
+	h.AddProcess(fakehost.Process{Pid: 80, PPid: 1, Cmdline: []string{"redis-server"}, StartTime: 80, Cgroup: "0::/kubepods/pod2/" + newId})
+	source := &fakeSource{batches: [][]cnproc.Event{
+		{{Type: cnproc.EventFork, Pid: 60, Tgid: 60, ParentPid: 50, ParentTgid: 50}},
+		{{Type: cnproc.EventFork, Pid: 70, Tgid: 60, ParentPid: 60, ParentTgid: 60}},
+		{{Type: cnproc.EventFork, Pid: 61, Tgid: 61, ParentPid: 60, ParentTgid: 60}, {Type: cnproc.EventExit, Pid: 61, Tgid: 61}},
+		{{Type: cnproc.EventExit, Pid: 60, Tgid: 60}},
+		{{Type: cnproc.EventFork, Pid: 80, Tgid: 80, ParentPid: 1, ParentTgid: 1}},
+	}}
+	if err := RunProcConnector(source); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+
+	var got []string
+	for _, event := range processEvents {
+		got = append(got, event.Type+" "+event.Source+" "+event.ProcessId+" "+event.ProcessName+" "+event.Uid+" "+event.Cwd+" "+event.PodName)
+	}
+	want := []string{
+		"started connector 60 sh 33 /tmp web",
+		"started connector 61  0  ",
+		"exited connector 61  0  ",
+		"exited connector 60 sh 33  web",
+		"started connector 80 redis-server 0  ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if ref := processEvents[len(processEvents)-1].ContainerRef; ref.ContainerId != newId || ref.Runtime == "" {
+		t.Errorf("got %+v, want container %s", ref, newId)
+	}
+	if _, ok := findProcessKey(60); ok {
+		t.Error("pid 60 is still known after its exit")
+	}
+
+	// The next poll attributes redis-server like the connector did.
+	procs, err = procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pidMap, err := GetPidMapper(procs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refMap, _, _, err := GetContainerId(procs, pidMap, RuntimeDocker, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	polled := len(processEvents)
+	if _, err := GetProcessEvents(procs, refMap, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range processEvents[polled:] {
+		if event.ProcessId == "80" {
+			t.Errorf("got %s event %+v for pid 80 from the poll", event.Type, event)
+		}
+	}
+}
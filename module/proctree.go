@@ -0,0 +1,132 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ProcTreeNode is a process in a ProcTree, with the processes it spawned
+// as children.
+type ProcTreeNode struct {
+	ProcessName string          `json:"ProcessName"`
+	ProcessId   string          `json:"ProcessId"`
+	Cmdline     string          `json:"Cmdline"`
+	Uid         string          `json:"Uid"`
+	CpuUsage    string          `json:"CpuUsage"`
+	MemRss      string          `json:"MemoryRss"`
+	Children    []*ProcTreeNode `json:"Children,omitempty"`
+}
+
+// ProcTree is the process tree of a container, or of the host when
+// ContainerId is empty. A process whose parent belongs elsewhere (e.g. a
+// container's entrypoint, whose parent is the shim) is one of the Roots.
+type ProcTree struct {
+	ContainerRef
+	Roots []*ProcTreeNode `json:"Roots"`
+}
+
+func sortProcTreeNodes(nodes []*ProcTreeNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		a, _ := strconv.Atoi(nodes[i].ProcessId)
+		b, _ := strconv.Atoi(nodes[j].ProcessId)
+		return a < b
+	})
+	for _, node := range nodes {
+		sortProcTreeNodes(node.Children)
+	}
+}
+
+func GetProcTree(procs []procfs.Proc, cpuList []CpuUsage, memList []MemUsage, pidMap map[int]int, refMap map[int]ContainerRef) (string, error) {
+	nodes := make(map[int]*ProcTreeNode, len(procs))
+	trees := make(map[ContainerRef]*ProcTree)
+	var treeRefs []ContainerRef
+
+	for i, proc := range procs {
+		nodes[proc.Pid] = &ProcTreeNode{
+			ProcessName: proc.Stat.Comm,
+			ProcessId:   strconv.Itoa(proc.Pid),
+			Cmdline:     proc.CmdlineString(),
+			Uid:         strconv.FormatUint((uint64)(proc.Status.Uids[0]), 10),
+			CpuUsage:    fmt.Sprintf("%.3f%%", cpuList[i].PerCore),
+			MemRss:      formatMB(memList[i].Rss),
+		}
+	}
+
+	for _, proc := range procs {
+		pid := proc.Pid
+		ref, ok := refMap[pid]
+		if !ok {
+			continue
+		}
+
+		tree, ok := trees[ref]
+		if !ok {
+			tree = &ProcTree{ContainerRef: ref, Roots: make([]*ProcTreeNode, 0)}
+			trees[ref] = tree
+			treeRefs = append(treeRefs, ref)
+		}
+
+		ppid := pidMap[pid]
+		if parent, ok := nodes[ppid]; ok && refMap[ppid] == ref {
+			parent.Children = append(parent.Children, nodes[pid])
+		} else {
+			tree.Roots = append(tree.Roots, nodes[pid])
+		}
+	}
+
+	// The host comes first, the containers follow by pod name.
+	sort.Slice(treeRefs, func(i, j int) bool {
+		a, b := treeRefs[i], treeRefs[j]
+		if a.IsHost() != b.IsHost() {
+			return a.IsHost()
+		}
+		if a.PodName != b.PodName {
+			return a.PodName < b.PodName
+		}
+		return a.ContainerId < b.ContainerId
+	})
+
+	procTrees := make([]*ProcTree, 0, len(treeRefs))
+	for _, ref := range treeRefs {
+		sortProcTreeNodes(trees[ref].Roots)
+		procTrees = append(procTrees, trees[ref])
+	}
+
+	jsonData, err := json.MarshalIndent(procTrees, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
+
+// FilterProcTree keeps the trees whose container ID starts with container
+// or whose pod name, alone or as "<namespace>/<pod>", equals it. "Host"
+// selects the host tree.
+func FilterProcTree(procTreeJson []byte, container string) (string, error) {
+	var procTrees []*ProcTree
+
+	err := json.Unmarshal(procTreeJson, &procTrees)
+	if err != nil {
+		return "", err
+	}
+
+	filtered := make([]*ProcTree, 0)
+	for _, tree := range procTrees {
+		if tree.PodName == container || (tree.PodNamespace != "" && tree.PodNamespace+"/"+tree.PodName == container) ||
+			(tree.ContainerId != "" && strings.HasPrefix(tree.ContainerId, container)) {
+			filtered = append(filtered, tree)
+		}
+	}
+
+	jsonData, err := json.MarshalIndent(filtered, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
@@ -0,0 +1,105 @@
+package module
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"container-agent/fakehost"
+)
+
+// procTreeLines renders each tree as "<ref>: <roots>", a node as its pid
+// followed by its children in parentheses.
+func procTreeLines(t *testing.T, procTreeJson string) []string {
+	t.Helper()
+	var procTrees []*ProcTree
+	if err := json.Unmarshal([]byte(procTreeJson), &procTrees); err != nil {
+		t.Fatal(err)
+	}
+	var render func(nodes []*ProcTreeNode) string
+	render = func(nodes []*ProcTreeNode) string {
+		var parts []string
+		for _, node := range nodes {
+			part := node.ProcessId
+			if len(node.Children) > 0 {
+				part += "(" + render(node.Children) + ")"
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, " ")
+	}
+	lines := make([]string, 0)
+	for _, tree := range procTrees {
+		lines = append(lines, tree.ContainerRef.String()+": "+render(tree.Roots))
+	}
+	return lines
+}
+
+func TestGetProcTree(t *testing.T) {
+	h := newHost(t)
+
+	apiId, webId, bareId := containerIdOf('a'), containerIdOf('b'), containerIdOf('c')
+	api := ContainerRef{PodName: "api", PodNamespace: "payments", ContainerId: apiId}
+	web := podRef("web", webId)
+	bare := ContainerRef{ContainerId: bareId}
+
+	h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}})
+	h.AddProcess(fakehost.Process{Pid: 400, PPid: 1, Cmdline: []string{"containerd-shim-runc-v2"}})
+	h.AddProcess(fakehost.Process{Pid: 401, PPid: 400, Cmdline: []string{"sshd"}})
+	// The shim is the parent of every container's first process.
+	h.AddProcess(fakehost.Process{Pid: 410, PPid: 400, Cmdline: []string{"nginx"}})
+	h.AddProcess(fakehost.Process{Pid: 411, PPid: 410, Cmdline: []string{"nginx: worker"}})
+	h.AddProcess(fakehost.Process{Pid: 420, PPid: 400, Cmdline: []string{"api"}})
+	// Entered with exec, its parent is on the host.
+	h.AddProcess(fakehost.Process{Pid: 1000, PPid: 1, Cmdline: []string{"sh"}})
+	h.AddProcess(fakehost.Process{Pid: 1001, PPid: 1000, Cmdline: []string{"ps"}})
+	h.AddProcess(fakehost.Process{Pid: 430, PPid: 400, Cmdline: []string{"worker"}})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pidMap, err := GetPidMapper(procs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refMap := map[int]ContainerRef{1: hostRef, 400: hostRef, 401: hostRef, 410: web, 411: web, 420: api, 1000: api, 1001: api, 430: bare}
+
+	procTree, err := GetProcTree(procs, make([]CpuUsage, len(procs)), make([]MemUsage, len(procs)), pidMap, refMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The host comes first, then the containers by pod name; roots are
+	// in pid order.
+	want := []string{
+		"Host: 1(400(401))",
+		bareId + ": 430",
+		"payments/api/" + apiId + ": 420 1000(1001)",
+		"web/" + webId + ": 410(411)",
+	}
+	if got := procTreeLines(t, procTree); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, tc := range []struct {
+		container string
+		want      []string
+	}{
+		{"Host", want[:1]},
+		{apiId[:12], want[2:3]},
+		{"api", want[2:3]},
+		{"payments/api", want[2:3]},
+		{"web", want[3:]},
+		{"default/web", []string{}},
+		{"db", []string{}},
+	} {
+		filtered, err := FilterProcTree([]byte(procTree), tc.container)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := procTreeLines(t, filtered); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("?container=%s: got %q, want %q", tc.container, got, tc.want)
+		}
+	}
+}
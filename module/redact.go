@@ -0,0 +1,196 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"path"
+	"strings"
+)
+
+// DefaultRedactPatterns are used unless the configuration sets others.
+var DefaultRedactPatterns = []string{
+	"*PASSWORD*",
+	"*PASSWD*",
+	"*SECRET*",
+	"*TOKEN*",
+	"*CREDENTIAL*",
+	"*API_KEY*",
+	"*APIKEY*",
+	"*PRIVATE_KEY*",
+	"--secret=",
+}
+
+const redactedValue = "[REDACTED]"
+
+// loaderVariables are the environment variables GetInjectionInfo looks at.
+// readAllProcs keeps them even when the environment is not captured.
+var loaderVariables = []string{"LD_PRELOAD", "LD_LIBRARY_PATH"}
+
+// captureEnviron and redactor are set by ConfigureCapture.
+var (
+	captureEnviron = false
+	redactor, _    = NewRedactor(DefaultRedactPatterns)
+)
+
+// ConfigureCapture sets whether the environment of processes is captured
+// and the patterns of what is redacted from it and from command lines.
+// nil patterns keep DefaultRedactPatterns, an empty list disables
+// redaction. It must be called before the first Monitoring() run.
+func ConfigureCapture(environ bool, patterns []string) error {
+	if patterns == nil {
+		patterns = DefaultRedactPatterns
+	}
+	newRedactor, err := NewRedactor(patterns)
+	if err != nil {
+		return err
+	}
+	captureEnviron = environ
+	redactor = newRedactor
+	return nil
+}
+
+// Redactor masks the values of environment variables and arguments whose
+// name matches one of its patterns. Patterns are shell globs matched
+// case-insensitively against the name, with leading dashes stripped from
+// argument names; a pattern ending in "=" (e.g. "--secret=") matches that
+// exact name. Both "--name=value" and "--name value" arguments are masked.
+type Redactor struct {
+	patterns []string
+}
+
+// NewRedactor checks patterns. An empty list disables redaction.
+func NewRedactor(patterns []string) (*Redactor, error) {
+	redactor := &Redactor{}
+	for _, pattern := range patterns {
+		pattern = strings.ToUpper(pattern)
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+		redactor.patterns = append(redactor.patterns, pattern)
+	}
+	return redactor, nil
+}
+
+func (r *Redactor) matchName(name string) bool {
+	name = strings.ToUpper(strings.TrimLeft(name, "-"))
+	if name == "" {
+		return false
+	}
+	for _, pattern := range r.patterns {
+		if strings.HasSuffix(pattern, "=") {
+			if name == strings.TrimLeft(strings.TrimSuffix(pattern, "="), "-") {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactEnviron returns environ with the values of matching variables
+// masked.
+func (r *Redactor) RedactEnviron(environ []string) []string {
+	redacted := make([]string, 0, len(environ))
+	for _, variable := range environ {
+		name, _, found := strings.Cut(variable, "=")
+		if found && r.matchName(name) {
+			variable = name + "=" + redactedValue
+		}
+		redacted = append(redacted, variable)
+	}
+	return redacted
+}
+
+// RedactArgs returns args with the values of matching arguments masked.
+// "NAME=value" arguments are handled like environment variables, as
+// shells and env(1) take them.
+func (r *Redactor) RedactArgs(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+	redacted := make([]string, 0, len(args))
+	maskNext := false
+	for _, arg := range args {
+		if maskNext {
+			redacted = append(redacted, redactedValue)
+			maskNext = false
+			continue
+		}
+		if name, _, found := strings.Cut(arg, "="); found {
+			if r.matchName(name) {
+				arg = name + "=" + redactedValue
+			}
+		} else if strings.HasPrefix(arg, "-") && r.matchName(arg) {
+			maskNext = true
+		}
+		redacted = append(redacted, arg)
+	}
+	return redacted
+}
+
+// RedactProc masks the command line and environment of proc.
+func (r *Redactor) RedactProc(proc *procfs.Proc) {
+	proc.Cmdline = r.RedactArgs(proc.Cmdline)
+	if proc.Environ != nil {
+		proc.Environ = r.RedactEnviron(proc.Environ)
+	}
+}
+
+// readProc reads a process from procFS, with its environment if captured,
+// and redacts it. Every collector goes through it (or readAllProcs) so
+// nothing unredacted reaches the output directory.
+func readProc(pid int) (procfs.Proc, error) {
+	proc, err := procFS.Proc(pid)
+	if err != nil {
+		return proc, err
+	}
+	if captureEnviron {
+		proc.Environ, _ = procFS.Environ(pid)
+	}
+	redactor.RedactProc(&proc)
+	return proc, nil
+}
+
+// readProcBasic is readProc for the part procfs.FS.ProcBasic reads.
+func readProcBasic(pid int) (procfs.Proc, error) {
+	proc, err := procFS.ProcBasic(pid)
+	if err != nil {
+		return proc, err
+	}
+	redactor.RedactProc(&proc)
+	return proc, nil
+}
+
+// keepLoaderVariables returns the loaderVariables of environ.
+func keepLoaderVariables(environ []string) []string {
+	var kept []string
+	for _, variable := range environ {
+		name, _, _ := strings.Cut(variable, "=")
+		for _, loaderVariable := range loaderVariables {
+			if name == loaderVariable {
+				kept = append(kept, variable)
+			}
+		}
+	}
+	return kept
+}
+
+// readAllProcs is readProc for every process, except that the environment
+// is always read, once per run: when it is not captured, only the
+// loaderVariables are kept, for GetInjectionInfo.
+func readAllProcs() ([]procfs.Proc, error) {
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		return nil, err
+	}
+	for i := range procs {
+		procs[i].Environ, _ = procFS.Environ(procs[i].Pid)
+		if !captureEnviron {
+			procs[i].Environ = keepLoaderVariables(procs[i].Environ)
+		}
+		redactor.RedactProc(&procs[i])
+	}
+	return procs, nil
+}
@@ -0,0 +1,67 @@
+package module
+
+import (
+	"reflect"
+	"testing"
+
+	"container-agent/fakehost"
+)
+
+func TestRedactor(t *testing.T) {
+	redactor, err := NewRedactor(DefaultRedactPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"flag with value", []string{"app", "--db-password=hunter2", "--port=80"}, []string{"app", "--db-password=[REDACTED]", "--port=80"}},
+		{"flag then value", []string{"app", "--token", "abc", "--verbose"}, []string{"app", "--token", "[REDACTED]", "--verbose"}},
+		{"exact name", []string{"app", "--secret=abc", "--secret-file=/run/secret"}, []string{"app", "--secret=[REDACTED]", "--secret-file=[REDACTED]"}},
+		{"assignment", []string{"env", "GITHUB_TOKEN=abc", "make"}, []string{"env", "GITHUB_TOKEN=[REDACTED]", "make"}},
+		{"untouched", []string{"nginx", "-g", "daemon off;"}, []string{"nginx", "-g", "daemon off;"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactor.RedactArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	got := redactor.RedactEnviron([]string{"PATH=/bin", "MYSQL_ROOT_PASSWORD=root", "aws_secret_access_key=x"})
+	want := []string{"PATH=/bin", "MYSQL_ROOT_PASSWORD=[REDACTED]", "aws_secret_access_key=[REDACTED]"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := NewRedactor([]string{"[PASSWORD"}); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
+
+func TestReadAllProcsRedacts(t *testing.T) {
+	h := newHost(t)
+	t.Cleanup(func() { ConfigureCapture(false, nil) })
+	if err := ConfigureCapture(true, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	h.AddProcess(fakehost.Process{Pid: 10, Cmdline: []string{"java", "-jar", "app.jar", "--api-token", "abc"}, Cwd: "/srv", Exe: "/usr/bin/java",
+		Environ: []string{"HOME=/root", "DB_PASSWORD=hunter2"}})
+
+	procs, err := readAllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc := procs[0]
+	if proc.CmdlineString() != "java -jar app.jar --api-token [REDACTED]" || proc.Cwd != "/srv" || proc.Exe != "/usr/bin/java" {
+		t.Errorf("unexpected process %+v", proc)
+	}
+	if !reflect.DeepEqual(proc.Environ, []string{"HOME=/root", "DB_PASSWORD=[REDACTED]"}) {
+		t.Errorf("unexpected environ %q", proc.Environ)
+	}
+}
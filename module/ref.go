@@ -0,0 +1,85 @@
+package module
+
+// ContainerRef identifies the container a process runs in, with the pod
+// the kubelet started it for. Pod fields are empty for containers no
+// kubelet started. Workload is the workload managing the pod, e.g.
+// "deployment payments/api", when the Kubernetes API is watched. Host
+// processes get hostRef, which has no ContainerId and "Host" as PodName, so
+// responses read the same as before for the host.
+// Embedded in a response, it adds its fields to the response's own.
+type ContainerRef struct {
+	PodName       string `json:"PodName"`
+	ContainerId   string `json:"ContainerId"`
+	PodNamespace  string `json:"PodNamespace"`
+	PodUid        string `json:"PodUid"`
+	ContainerName string `json:"ContainerName"`
+	SandboxId     string `json:"SandboxId"`
+	Image         string `json:"Image"`
+	Runtime       string `json:"Runtime"`
+	Workload      string `json:"Workload,omitempty"`
+}
+
+var hostRef = ContainerRef{PodName: "Host"}
+
+func newContainerRef(containerId string, runtime string, metadata ContainerMetadata) ContainerRef {
+	ref := ContainerRef{
+		PodName:       metadata.PodName,
+		ContainerId:   containerId,
+		PodNamespace:  metadata.PodNamespace,
+		PodUid:        metadata.PodUid,
+		ContainerName: metadata.ContainerName,
+		SandboxId:     metadata.SandboxId,
+		Image:         metadata.Image,
+		Runtime:       runtime,
+	}
+	if pod, ok := getKubePod(metadata.PodUid, metadata.PodNamespace, metadata.PodName); ok {
+		ref.Workload = pod.workloadName()
+	}
+	return ref
+}
+
+// resolveContainerRef returns the ref of a container from its entry in
+// metadataMap, else from its state file. runtime is the runtime owning the
+// container if known; otherwise the metadata or the state directories
+// tell, or else defaultRuntime. A container whose metadata can't be read
+// gets a ref with only its ID and runtime: it is still a container, its pod
+// is unknown.
+func resolveContainerRef(containerId string, runtime string, defaultRuntime string, metadataMap map[string]ContainerMetadata) ContainerRef {
+	metadata, fromRuntime := metadataMap[containerId]
+	if runtime == "" {
+		if fromRuntime {
+			runtime = metadata.runtime
+		} else {
+			runtime = findContainerRuntime(containerId, defaultRuntime)
+		}
+	}
+	if !fromRuntime {
+		var err error
+		metadata, err = readFileMetadata(containerId, runtime)
+		if err != nil {
+			return ContainerRef{ContainerId: containerId, Runtime: runtime}
+		}
+	}
+	return newContainerRef(containerId, runtime, metadata)
+}
+
+// IsHost reports whether r is the host rather than a container.
+func (r ContainerRef) IsHost() bool {
+	return r.ContainerId == ""
+}
+
+// String returns "Host" or "<namespace>/<pod>/<containerId>", leaving out
+// what is unknown.
+func (r ContainerRef) String() string {
+	if r.IsHost() {
+		return r.PodName
+	}
+	s := r.ContainerId
+	if r.PodName != "" {
+		s = r.PodName + "/" + s
+	}
+	if r.PodNamespace != "" {
+		s = r.PodNamespace + "/" + s
+	}
+	return s
+}
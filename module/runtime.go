@@ -0,0 +1,271 @@
+package module
+
+import (
+	"container-agent/docker"
+	"container-agent/procfs"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Container runtimes.
+const (
+	RuntimeDocker     = "docker"
+	RuntimeContainerd = "containerd"
+	RuntimeCrio       = "crio"
+)
+
+// How a runtime was found.
+const (
+	DetectedBySocket        = "socket"
+	DetectedByStateDir      = "state-dir"
+	DetectedByKubeletFlag   = "kubelet-flag"
+	DetectedByKubeletConfig = "kubelet-config"
+)
+
+// runtimeLayout is where a runtime keeps its sockets and per-container
+// state on the host. Sockets are host paths, stateDir is the container
+// state directory as mounted below hostRoot by the daemonset.
+type runtimeLayout struct {
+	name     string
+	sockets  []string
+	stateDir string
+}
+
+var runtimeLayouts = []runtimeLayout{
+	{RuntimeDocker, []string{"/run/docker.sock", "/run/cri-dockerd.sock"}, "/docker/containers"},
+	{RuntimeContainerd, []string{"/run/containerd/containerd.sock", "/run/k3s/containerd/containerd.sock"}, "/k8s.io"},
+	{RuntimeCrio, []string{"/run/crio/crio.sock"}, "/containers/storage/overlay-containers"},
+}
+
+// Runtime is a container runtime found on the node. Socket is the host
+// path of its API socket, empty if only its state was found. Kubelet tells
+// the runtime the kubelet talks to. Containers counts the containers with
+// processes attributed to it. MetadataError tells why its socket couldn't
+// be asked for container metadata, its containers fell back to the state
+// files then.
+type Runtime struct {
+	Name          string   `json:"Name"`
+	Socket        string   `json:"Socket"`
+	Version       string   `json:"Version"`
+	Kubelet       bool     `json:"Kubelet"`
+	DetectedBy    []string `json:"DetectedBy"`
+	Containers    int      `json:"Containers"`
+	MetadataError string   `json:"MetadataError,omitempty"`
+}
+
+// runtimeVersionProbe returns what asks runtime for its version through
+// its socket, given as a path below hostRoot: the Engine API on docker.sock,
+// CRI on any other socket, cri-dockerd's included.
+func runtimeVersionProbe(runtime Runtime) func(socket string) (string, error) {
+	if runtime.Socket == dockerEngineSocket {
+		return dockerVersion
+	}
+	return criVersion
+}
+
+const runtimeProbeTimeout = 2 * time.Second
+
+// dockerVersion asks the Docker Engine API for its version.
+func dockerVersion(socket string) (string, error) {
+	client := docker.New(socket, runtimeProbeTimeout)
+	defer client.Close()
+	return client.Version()
+}
+
+// hostSocketPath maps a socket path or unix:// endpoint of the host to its
+// path below hostRoot. /var/run is a symlink to /run on every distribution
+// that matters, and only /run is mounted.
+func hostSocketPath(endpoint string) string {
+	socket := strings.TrimPrefix(endpoint, "unix://")
+	if strings.HasPrefix(socket, "/var/run/") {
+		socket = strings.TrimPrefix(socket, "/var")
+	}
+	return hostRoot + socket
+}
+
+// isSocket reports whether a socket exists at path.
+func isSocket(path string) bool {
+	fileInfo, err := os.Stat(path)
+	return err == nil && fileInfo.Mode()&os.ModeSocket != 0
+}
+
+// hasEntries reports whether dir exists and isn't empty. The daemonset
+// mounts the state directories of every runtime, so they exist, empty,
+// on nodes without it.
+func hasEntries(dir string) bool {
+	files, err := ioutil.ReadDir(dir)
+	return err == nil && len(files) > 0
+}
+
+// endpointRuntime tells which runtime serves a CRI endpoint.
+func endpointRuntime(endpoint string) string {
+	switch {
+	case strings.Contains(endpoint, "containerd"):
+		return RuntimeContainerd
+	case strings.Contains(endpoint, "crio"):
+		return RuntimeCrio
+	case strings.Contains(endpoint, "docker"):
+		return RuntimeDocker
+	}
+	return ""
+}
+
+// flagValue returns the value of a "--name=value" or "--name value" flag.
+func flagValue(cmdline []string, name string) string {
+	for i, arg := range cmdline {
+		if strings.HasPrefix(arg, "--"+name+"=") {
+			return strings.TrimPrefix(arg, "--"+name+"=")
+		}
+		if arg == "--"+name && i+1 < len(cmdline) {
+			return cmdline[i+1]
+		}
+	}
+	return ""
+}
+
+// readKubeletConfig returns containerRuntimeEndpoint from a kubelet config
+// file. The file is YAML, but the key is at the top level and its value a
+// plain string, so a line scan does. It is read through the kubelet's root,
+// relative paths through its working directory.
+func readKubeletConfig(proc procfs.Proc, configPath string) string {
+	if !filepath.IsAbs(configPath) {
+		configPath = filepath.Join(proc.Cwd, configPath)
+	}
+	data, err := os.ReadFile(procFS.Path(strconv.Itoa(proc.Pid), "root", configPath))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "containerRuntimeEndpoint:") {
+			value := strings.TrimPrefix(line, "containerRuntimeEndpoint:")
+			return strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return ""
+}
+
+// kubeletEndpoint returns the CRI endpoint the kubelet is configured with
+// and where it was found. The flag overrides the config file.
+func kubeletEndpoint(procs []procfs.Proc) (string, string) {
+	for _, proc := range procs {
+		if proc.Stat.Comm != "kubelet" {
+			continue
+		}
+		if endpoint := flagValue(proc.Cmdline, "container-runtime-endpoint"); endpoint != "" {
+			return endpoint, DetectedByKubeletFlag
+		}
+		if configPath := flagValue(proc.Cmdline, "config"); configPath != "" {
+			if endpoint := readKubeletConfig(proc, configPath); endpoint != "" {
+				return endpoint, DetectedByKubeletConfig
+			}
+		}
+	}
+	return "", ""
+}
+
+// DiscoverRuntimes finds the container runtimes of the node by probing
+// their sockets and state directories and by asking the kubelet's flags
+// and config file. Several runtimes may run side by side.
+func DiscoverRuntimes(procs []procfs.Proc) ([]Runtime, error) {
+	runtimes := make([]Runtime, 0)
+	endpoint, kubeletSource := kubeletEndpoint(procs)
+	kubeletRuntime := endpointRuntime(endpoint)
+
+	for _, layout := range runtimeLayouts {
+		runtime := Runtime{Name: layout.name, DetectedBy: make([]string, 0)}
+
+		sockets := layout.sockets
+		if layout.name == kubeletRuntime {
+			runtime.Kubelet = true
+			runtime.DetectedBy = append(runtime.DetectedBy, kubeletSource)
+			sockets = append([]string{strings.TrimPrefix(endpoint, "unix://")}, sockets...)
+		}
+		for _, socket := range sockets {
+			if socketPath := hostSocketPath(socket); isSocket(socketPath) {
+				runtime.Socket = strings.TrimPrefix(socketPath, hostRoot)
+				runtime.DetectedBy = append(runtime.DetectedBy, DetectedBySocket)
+				break
+			}
+		}
+		if hasEntries(hostRoot + layout.stateDir) {
+			runtime.DetectedBy = append(runtime.DetectedBy, DetectedByStateDir)
+		}
+		if len(runtime.DetectedBy) == 0 {
+			continue
+		}
+
+		// Runtimes get upgraded in place, so they are asked every time.
+		if runtime.Socket != "" {
+			runtime.Version, _ = runtimeVersionProbe(runtime)(hostRoot + runtime.Socket)
+		}
+		runtimes = append(runtimes, runtime)
+	}
+
+	return runtimes, nil
+}
+
+// DefaultRuntime returns the runtime containers are attributed to when
+// nothing else tells: the kubelet's, else the only one found, else docker.
+func DefaultRuntime(runtimes []Runtime) string {
+	for _, runtime := range runtimes {
+		if runtime.Kubelet {
+			return runtime.Name
+		}
+	}
+	if len(runtimes) == 1 {
+		return runtimes[0].Name
+	}
+	return RuntimeDocker
+}
+
+// containerStateFile returns the state file of a container below hostRoot,
+// the one readFileMetadata reads.
+func containerStateFile(containerId string, runtime string) string {
+	switch runtime {
+	case RuntimeCrio:
+		return hostRoot + "/containers/storage/overlay-containers/" + containerId + "/userdata/config.json"
+	case RuntimeContainerd:
+		return hostRoot + "/k8s.io/" + containerId + "/config.json"
+	}
+	return hostRoot + "/docker/containers/" + containerId + "/config.v2.json"
+}
+
+// findContainerRuntime tells which runtime owns a container whose cgroup
+// doesn't name it, by looking for its state in the state directory of each
+// runtime. defaultRuntime is returned if none has it.
+func findContainerRuntime(containerId string, defaultRuntime string) string {
+	for _, layout := range runtimeLayouts {
+		if _, err := os.Stat(containerStateFile(containerId, layout.name)); err == nil {
+			return layout.name
+		}
+	}
+	return defaultRuntime
+}
+
+// GetRuntimeInfo counts the containers of runtimeMap, as returned by
+// GetContainerId, per runtime.
+func GetRuntimeInfo(runtimes []Runtime, runtimeMap map[string]string) (string, error) {
+	containers := make(map[string]int)
+	for _, runtime := range runtimeMap {
+		containers[runtime]++
+	}
+	for i := range runtimes {
+		runtimes[i].Containers = containers[runtimes[i].Name]
+	}
+	sort.SliceStable(runtimes, func(i, j int) bool {
+		return runtimes[i].Kubelet && !runtimes[j].Kubelet
+	})
+
+	jsonData, err := json.MarshalIndent(runtimes, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	return string(jsonData), nil
+}
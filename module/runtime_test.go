@@ -0,0 +1,95 @@
+package module
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"container-agent/fakehost"
+	"container-agent/procfs"
+)
+
+func TestDiscoverRuntimes(t *testing.T) {
+	h := newHost(t)
+
+	// docker answers on its socket, containerd only left state behind and
+	// is what the kubelet config points at.
+	dockerSocket := h.Listen("run/docker.sock")
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"Version":"20.10.21","ApiVersion":"1.41"}`))
+	})}
+	go server.Serve(dockerSocket)
+	t.Cleanup(func() { server.Close() })
+
+	dockerId := containerIdOf('a')
+	containerdId := containerIdOf('b')
+	h.AddDockerContainer(dockerId, "docker-pod", nil)
+	h.AddContainerdContainer(fakehost.ContainerdContainer{Id: containerdId, SandboxName: "containerd-pod", Type: "container", Snapshot: 2})
+
+	h.AddProcess(fakehost.Process{Pid: 1, Cmdline: []string{"/sbin/init"}})
+	h.AddProcess(fakehost.Process{Pid: 50, PPid: 1, Cmdline: []string{"/usr/bin/kubelet", "--config", "/var/lib/kubelet/config.yaml"}})
+	h.WriteFile("proc/50/root/var/lib/kubelet/config.yaml", "apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\ncontainerRuntimeEndpoint: \"unix:///var/run/containerd/containerd.sock\"\n")
+	// Both cgroupfs, neither names its runtime.
+	h.AddProcess(fakehost.Process{Pid: 100, PPid: 1, Cmdline: []string{"nginx"}, Cgroup: "0::/kubepods/besteffort/pod1/" + dockerId})
+	h.AddProcess(fakehost.Process{Pid: 200, PPid: 1, Cmdline: []string{"redis-server"}, Cgroup: "0::/kubepods/besteffort/pod2/" + containerdId})
+
+	procs, err := procFS.AllProcs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtimes, err := DiscoverRuntimes(procs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Runtime{
+		{Name: RuntimeDocker, Socket: "/run/docker.sock", Version: "20.10.21", DetectedBy: []string{DetectedBySocket, DetectedByStateDir}},
+		{Name: RuntimeContainerd, Kubelet: true, DetectedBy: []string{DetectedByKubeletConfig, DetectedByStateDir}},
+	}
+	if !reflect.DeepEqual(runtimes, want) {
+		t.Errorf("got %+v, want %+v", runtimes, want)
+	}
+	if runtime := DefaultRuntime(runtimes); runtime != RuntimeContainerd {
+		t.Errorf("got default runtime %q", runtime)
+	}
+
+	pidMap, _ := GetPidMapper(procs)
+	refMap, _, runtimeMap, err := GetContainerId(procs, pidMap, DefaultRuntime(runtimes), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refMap[100].String() != "docker-pod/"+dockerId || refMap[200].String() != "containerd-pod/"+containerdId {
+		t.Errorf("got %v", refMap)
+	}
+	wantRuntimes := map[string]string{dockerId: RuntimeDocker, containerdId: RuntimeContainerd}
+	if !reflect.DeepEqual(runtimeMap, wantRuntimes) {
+		t.Errorf("got runtimes %v, want %v", runtimeMap, wantRuntimes)
+	}
+
+	// Without docker.sock, docker is asked over CRI through cri-dockerd.
+	t.Run("cri-dockerd", func(t *testing.T) {
+		h := newHost(t)
+		h.ServeCri("run/cri-dockerd.sock", &fakehost.CriServer{RuntimeName: "docker", RuntimeVersion: "24.0.7"})
+
+		runtimes, err := DiscoverRuntimes(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []Runtime{{Name: RuntimeDocker, Socket: "/run/cri-dockerd.sock", Version: "24.0.7", DetectedBy: []string{DetectedBySocket}}}
+		if !reflect.DeepEqual(runtimes, want) {
+			t.Errorf("got %+v, want %+v", runtimes, want)
+		}
+	})
+}
+
+func TestKubeletEndpointFlag(t *testing.T) {
+	kubelet := procfs.Proc{Pid: 50, Stat: procfs.ProcStat{Comm: "kubelet"},
+		Cmdline: []string{"/usr/bin/kubelet", "--container-runtime-endpoint=unix:///run/crio/crio.sock", "--config=/etc/kubelet.yaml"}}
+	endpoint, source := kubeletEndpoint([]procfs.Proc{kubelet})
+	if endpoint != "unix:///run/crio/crio.sock" || source != DetectedByKubeletFlag || endpointRuntime(endpoint) != RuntimeCrio {
+		t.Errorf("got %q from %q", endpoint, source)
+	}
+}
@@ -0,0 +1,96 @@
+package module
+
+import (
+	"container-agent/procfs"
+	"strconv"
+)
+
+// ProcessSecurity is the identity and privilege of a process. Uid and Gid
+// hold the real, effective and saved IDs, in that order.
+type ProcessSecurity struct {
+	Uid        []string `json:"Uid"`
+	Gid        []string `json:"Gid"`
+	CapEff     []string `json:"CapEff"`
+	CapPrm     []string `json:"CapPrm"`
+	CapBnd     []string `json:"CapBnd"`
+	Seccomp    string   `json:"Seccomp"`
+	NoNewPrivs bool     `json:"NoNewPrivs"`
+}
+
+// ContainerSecurity rolls up the ProcessSecurity of a container's
+// processes. CapEff is the union of their effective capabilities.
+type ContainerSecurity struct {
+	RootProcessIds         []string `json:"RootProcessIds"`
+	SysAdminProcessIds     []string `json:"SysAdminProcessIds"`
+	RootSysAdminProcessIds []string `json:"RootSysAdminProcessIds"`
+	NoSeccompProcessIds    []string `json:"NoSeccompProcessIds"`
+	CapEff                 []string `json:"CapEff"`
+}
+
+func seccompModeName(mode int) string {
+	switch mode {
+	case procfs.SeccompDisabled:
+		return "disabled"
+	case procfs.SeccompStrict:
+		return "strict"
+	case procfs.SeccompFilter:
+		return "filter"
+	}
+	return strconv.Itoa(mode)
+}
+
+func formatIds(ids [4]uint32) []string {
+	return []string{
+		strconv.FormatUint((uint64)(ids[0]), 10),
+		strconv.FormatUint((uint64)(ids[1]), 10),
+		strconv.FormatUint((uint64)(ids[2]), 10),
+	}
+}
+
+func GetProcessSecurity(proc procfs.Proc) ProcessSecurity {
+	return ProcessSecurity{
+		Uid:        formatIds(proc.Status.Uids),
+		Gid:        formatIds(proc.Status.Gids),
+		CapEff:     procfs.CapabilityNames(proc.Status.CapEff),
+		CapPrm:     procfs.CapabilityNames(proc.Status.CapPrm),
+		CapBnd:     procfs.CapabilityNames(proc.Status.CapBnd),
+		Seccomp:    seccompModeName(proc.Status.Seccomp),
+		NoNewPrivs: proc.Status.NoNewPrivs,
+	}
+}
+
+// GetContainerSecurity rolls up the privileges of a container's processes.
+// A process counts as root when its effective UID is 0; user namespaces
+// are not taken into account.
+func GetContainerSecurity(procs []procfs.Proc) ContainerSecurity {
+	containerSecurity := ContainerSecurity{
+		RootProcessIds:         make([]string, 0),
+		SysAdminProcessIds:     make([]string, 0),
+		RootSysAdminProcessIds: make([]string, 0),
+		NoSeccompProcessIds:    make([]string, 0),
+	}
+
+	var capEff uint64
+	for _, proc := range procs {
+		pid := strconv.Itoa(proc.Pid)
+		isRoot := proc.Status.Uids[1] == 0
+		isSysAdmin := procfs.HasCapability(proc.Status.CapEff, procfs.CapSysAdmin)
+
+		if isRoot {
+			containerSecurity.RootProcessIds = append(containerSecurity.RootProcessIds, pid)
+		}
+		if isSysAdmin {
+			containerSecurity.SysAdminProcessIds = append(containerSecurity.SysAdminProcessIds, pid)
+		}
+		if isRoot && isSysAdmin {
+			containerSecurity.RootSysAdminProcessIds = append(containerSecurity.RootSysAdminProcessIds, pid)
+		}
+		if proc.Status.Seccomp == procfs.SeccompDisabled {
+			containerSecurity.NoSeccompProcessIds = append(containerSecurity.NoSeccompProcessIds, pid)
+		}
+		capEff |= proc.Status.CapEff
+	}
+	containerSecurity.CapEff = procfs.CapabilityNames(capEff)
+
+	return containerSecurity
+}
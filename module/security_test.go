@@ -0,0 +1,28 @@
+package module
+
+import (
+	"reflect"
+	"testing"
+
+	"container-agent/procfs"
+)
+
+func TestGetContainerSecurity(t *testing.T) {
+	procs := []procfs.Proc{
+		{Pid: 10, Status: procfs.ProcStatus{Uids: [4]uint32{0, 0, 0, 0}, CapEff: 1 << procfs.CapSysAdmin, Seccomp: procfs.SeccompDisabled}},
+		{Pid: 11, Status: procfs.ProcStatus{Uids: [4]uint32{1000, 0, 0, 0}, CapEff: 1, Seccomp: procfs.SeccompFilter}},
+		{Pid: 12, Status: procfs.ProcStatus{Uids: [4]uint32{1000, 1000, 1000, 1000}, CapEff: 1 << procfs.CapSysAdmin, Seccomp: procfs.SeccompFilter}},
+	}
+
+	got := GetContainerSecurity(procs)
+	want := ContainerSecurity{
+		RootProcessIds:         []string{"10", "11"},
+		SysAdminProcessIds:     []string{"10", "12"},
+		RootSysAdminProcessIds: []string{"10"},
+		NoSeccompProcessIds:    []string{"10"},
+		CapEff:                 []string{"CAP_CHOWN", "CAP_SYS_ADMIN"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
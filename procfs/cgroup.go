@@ -0,0 +1,36 @@
+package procfs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Cgroup is a line of /proc/[pid]/cgroup. The unified (v2) hierarchy has
+// HierarchyId 0 and no controllers.
+type Cgroup struct {
+	HierarchyId int
+	Controllers []string
+	Path        string
+}
+
+func ParseCgroups(data []byte) []Cgroup {
+	var cgroups []Cgroup
+
+	for _, line := range strings.Split(string(data), "\n") {
+		splitLine := strings.SplitN(line, ":", 3)
+		if len(splitLine) != 3 {
+			continue
+		}
+		hierarchyId, err := strconv.Atoi(splitLine[0])
+		if err != nil {
+			continue
+		}
+		var controllers []string
+		if splitLine[1] != "" {
+			controllers = strings.Split(splitLine[1], ",")
+		}
+		cgroups = append(cgroups, Cgroup{hierarchyId, controllers, splitLine[2]})
+	}
+
+	return cgroups
+}
@@ -0,0 +1,53 @@
+package procfs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ProcIO are the I/O counters of /proc/[pid]/io. RChar and WChar count
+// every byte passed to read(2) and write(2) and friends, pipes and sockets
+// included, while ReadBytes and WriteBytes only count what had to go to or
+// come from the storage layer.
+type ProcIO struct {
+	RChar               uint64
+	WChar               uint64
+	SyscR               uint64
+	SyscW               uint64
+	ReadBytes           uint64
+	WriteBytes          uint64
+	CancelledWriteBytes uint64
+}
+
+func ParseIO(data []byte) (ProcIO, error) {
+	var procIO ProcIO
+
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := splitStatusLine(line)
+		if !ok {
+			continue
+		}
+		counter, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return procIO, errMalformed("io")
+		}
+		switch key {
+		case "rchar":
+			procIO.RChar = counter
+		case "wchar":
+			procIO.WChar = counter
+		case "syscr":
+			procIO.SyscR = counter
+		case "syscw":
+			procIO.SyscW = counter
+		case "read_bytes":
+			procIO.ReadBytes = counter
+		case "write_bytes":
+			procIO.WriteBytes = counter
+		case "cancelled_write_bytes":
+			procIO.CancelledWriteBytes = counter
+		}
+	}
+
+	return procIO, nil
+}
@@ -0,0 +1,70 @@
+package procfs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Mapping is a line of /proc/[pid]/maps. Path is empty for anonymous
+// mappings and "[heap]", "[stack]", "[vdso]"... for the kernel's own.
+type Mapping struct {
+	Start  uint64
+	End    uint64
+	Perms  string
+	Offset uint64
+	Inode  uint64
+	Path   string
+}
+
+// IsExecutable reports whether the mapping may be executed.
+func (m Mapping) IsExecutable() bool {
+	return len(m.Perms) > 2 && m.Perms[2] == 'x'
+}
+
+// IsWritable reports whether the mapping may be written to.
+func (m Mapping) IsWritable() bool {
+	return len(m.Perms) > 1 && m.Perms[1] == 'w'
+}
+
+// ParseMaps parses /proc/[pid]/maps.
+func ParseMaps(data []byte) ([]Mapping, error) {
+	var mappings []Mapping
+
+	for _, line := range strings.Split(string(data), "\n") {
+		// The path is the rest of the line and may hold spaces.
+		fields := strings.SplitN(line, " ", 6)
+		if len(fields) < 5 {
+			continue
+		}
+		start, end, found := strings.Cut(fields[0], "-")
+		if !found {
+			return mappings, errMalformed("maps")
+		}
+		var mapping Mapping
+		var err error
+		if mapping.Start, err = strconv.ParseUint(start, 16, 64); err != nil {
+			return mappings, errMalformed("maps")
+		}
+		if mapping.End, err = strconv.ParseUint(end, 16, 64); err != nil {
+			return mappings, errMalformed("maps")
+		}
+		mapping.Perms = fields[1]
+		mapping.Offset, _ = strconv.ParseUint(fields[2], 16, 64)
+		mapping.Inode, _ = strconv.ParseUint(fields[4], 10, 64)
+		if len(fields) == 6 {
+			mapping.Path = strings.TrimLeft(fields[5], " ")
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+// Maps reads the memory mappings of a process. It needs ptrace access.
+func (fs FS) Maps(pid int) ([]Mapping, error) {
+	data, err := fs.readFile(strconv.Itoa(pid), "maps")
+	if err != nil {
+		return nil, err
+	}
+	return ParseMaps(data)
+}
@@ -0,0 +1,42 @@
+package procfs
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// NamespaceTypes are the entries of /proc/[pid]/ns the agent reads.
+var NamespaceTypes = []string{"pid", "net", "mnt", "ipc", "uts", "user", "cgroup"}
+
+// ParseNamespaceLink parses the target of a /proc/[pid]/ns link, such as
+// "net:[4026531992]", into its inode.
+func ParseNamespaceLink(link string) (string, uint64, error) {
+	bracket := strings.Index(link, ":[")
+	if bracket < 0 || !strings.HasSuffix(link, "]") {
+		return "", 0, errMalformed("ns link")
+	}
+	inode, err := strconv.ParseUint(link[bracket+2:len(link)-1], 10, 64)
+	if err != nil {
+		return "", 0, errMalformed("ns link")
+	}
+	return link[:bracket], inode, nil
+}
+
+// namespaces reads the namespace inodes of a process. Reading the links
+// needs ptrace access to the process; those that fail are left out.
+func (fs FS) namespaces(pidDir string) map[string]uint64 {
+	namespaces := make(map[string]uint64, len(NamespaceTypes))
+	for _, nsType := range NamespaceTypes {
+		link, err := os.Readlink(fs.Path(pidDir, "ns", nsType))
+		if err != nil {
+			continue
+		}
+		_, inode, err := ParseNamespaceLink(link)
+		if err != nil {
+			continue
+		}
+		namespaces[nsType] = inode
+	}
+	return namespaces
+}
@@ -0,0 +1,250 @@
+package procfs
+
+import (
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Socket is an entry of the socket tables of a network namespace,
+// /proc/[pid]/net/{tcp,tcp6,udp,udp6,unix}. Unix sockets have a Path
+// instead of addresses.
+type Socket struct {
+	Protocol      string
+	State         string
+	LocalAddress  string
+	RemoteAddress string
+	Path          string
+	Uid           uint32
+	Inode         uint64
+}
+
+// tcpStates are the TCP states of include/net/tcp_states.h, by their
+// number in the "st" column.
+var tcpStates = map[uint64]string{
+	0x01: "ESTABLISHED",
+	0x02: "SYN_SENT",
+	0x03: "SYN_RECV",
+	0x04: "FIN_WAIT1",
+	0x05: "FIN_WAIT2",
+	0x06: "TIME_WAIT",
+	0x07: "CLOSE",
+	0x08: "CLOSE_WAIT",
+	0x09: "LAST_ACK",
+	0x0A: "LISTEN",
+	0x0B: "CLOSING",
+	0x0C: "NEW_SYN_RECV",
+}
+
+var unixStates = map[uint64]string{
+	0x01: "UNCONNECTED",
+	0x02: "CONNECTING",
+	0x03: "CONNECTED",
+	0x04: "DISCONNECTING",
+}
+
+var unixTypes = map[string]string{
+	"0001": "unix_stream",
+	"0002": "unix_dgram",
+	"0005": "unix_seqpacket",
+}
+
+// unixAcceptCon is __SO_ACCEPTCON in the Flags column, set on listening
+// unix sockets.
+const unixAcceptCon = 0x10000
+
+// parseNetAddress parses an "address:port" of the ip socket tables. The
+// address is hex of the kernel's in-memory representation, i.e. each 32 bit
+// word in host (little endian) byte order.
+func parseNetAddress(field string) (string, error) {
+	splitField := strings.Split(field, ":")
+	if len(splitField) != 2 {
+		return "", errMalformed("socket address")
+	}
+	raw, err := hex.DecodeString(splitField[0])
+	if err != nil || (len(raw) != net.IPv4len && len(raw) != net.IPv6len) {
+		return "", errMalformed("socket address")
+	}
+	port, err := strconv.ParseUint(splitField[1], 16, 16)
+	if err != nil {
+		return "", errMalformed("socket address")
+	}
+
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+
+	return net.JoinHostPort(ip.String(), strconv.FormatUint(port, 10)), nil
+}
+
+// ParseNetIp parses /proc/net/{tcp,tcp6,udp,udp6}. protocol is the name
+// of the file, and tells how to read the state column.
+func ParseNetIp(data []byte, protocol string) ([]Socket, error) {
+	var sockets []Socket
+
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+
+		localAddress, err := parseNetAddress(fields[1])
+		if err != nil {
+			return sockets, err
+		}
+		remoteAddress, err := parseNetAddress(fields[2])
+		if err != nil {
+			return sockets, err
+		}
+		st, err := strconv.ParseUint(fields[3], 16, 8)
+		if err != nil {
+			return sockets, errMalformed(protocol)
+		}
+		uid, err := strconv.ParseUint(fields[7], 10, 32)
+		if err != nil {
+			return sockets, errMalformed(protocol)
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return sockets, errMalformed(protocol)
+		}
+
+		state := tcpStates[st]
+		if strings.HasPrefix(protocol, "udp") {
+			// udp reuses the tcp numbers: bound only, or connected.
+			if st == 0x07 {
+				state = "UNCONN"
+			} else if st == 0x01 {
+				state = "ESTABLISHED"
+			}
+		}
+		if state == "" {
+			state = fmt.Sprintf("0x%02X", st)
+		}
+
+		sockets = append(sockets, Socket{
+			Protocol:      protocol,
+			State:         state,
+			LocalAddress:  localAddress,
+			RemoteAddress: remoteAddress,
+			Uid:           (uint32)(uid),
+			Inode:         inode,
+		})
+	}
+
+	return sockets, nil
+}
+
+// ParseNetUnix parses /proc/net/unix.
+func ParseNetUnix(data []byte) ([]Socket, error) {
+	var sockets []Socket
+
+	lines := strings.Split(string(data), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil {
+			return sockets, errMalformed("unix")
+		}
+		st, err := strconv.ParseUint(fields[5], 16, 8)
+		if err != nil {
+			return sockets, errMalformed("unix")
+		}
+		inode, err := strconv.ParseUint(fields[6], 10, 64)
+		if err != nil {
+			return sockets, errMalformed("unix")
+		}
+
+		protocol, ok := unixTypes[fields[4]]
+		if !ok {
+			protocol = "unix"
+		}
+		state := unixStates[st]
+		if flags&unixAcceptCon != 0 {
+			state = "LISTEN"
+		}
+
+		var path string
+		if len(fields) > 7 {
+			path = strings.Join(fields[7:], " ")
+		}
+
+		sockets = append(sockets, Socket{
+			Protocol: protocol,
+			State:    state,
+			Path:     path,
+			Inode:    inode,
+		})
+	}
+
+	return sockets, nil
+}
+
+// NetSockets reads every socket table of the network namespace pid lives
+// in. Tables missing from the kernel (e.g. no IPv6) are skipped.
+func (fs FS) NetSockets(pid int) ([]Socket, error) {
+	var sockets []Socket
+	pidDir := strconv.Itoa(pid)
+
+	read := false
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		data, err := fs.readFile(pidDir, "net", protocol)
+		if err != nil {
+			continue
+		}
+		read = true
+		ipSockets, err := ParseNetIp(data, protocol)
+		if err != nil {
+			return sockets, err
+		}
+		sockets = append(sockets, ipSockets...)
+	}
+	if data, err := fs.readFile(pidDir, "net", "unix"); err == nil {
+		read = true
+		unixSockets, err := ParseNetUnix(data)
+		if err != nil {
+			return sockets, err
+		}
+		sockets = append(sockets, unixSockets...)
+	}
+
+	if !read {
+		return sockets, fmt.Errorf("procfs: no socket table readable for pid %d", pid)
+	}
+	return sockets, nil
+}
+
+// SocketInodes returns the inodes of the sockets pid has open, read from
+// the "socket:[inode]" links of /proc/[pid]/fd.
+func (fs FS) SocketInodes(pid int) ([]uint64, error) {
+	var inodes []uint64
+
+	fdDir := fs.Path(strconv.Itoa(pid), "fd")
+	fds, err := os.ReadDir(fdDir)
+	if err != nil {
+		return inodes, err
+	}
+
+	for _, fd := range fds {
+		link, err := os.Readlink(fdDir + "/" + fd.Name())
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		_, inode, err := ParseNamespaceLink(link)
+		if err != nil {
+			continue
+		}
+		inodes = append(inodes, inode)
+	}
+
+	return inodes, nil
+}
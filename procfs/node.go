@@ -0,0 +1,337 @@
+package procfs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CpuTimes is a cpu line of /proc/stat, in clock ticks. Name is "cpu" for
+// the sum over all CPUs and "cpuN" for each of them.
+type CpuTimes struct {
+	Name      string
+	User      uint64
+	Nice      uint64
+	System    uint64
+	Idle      uint64
+	IOWait    uint64
+	IRQ       uint64
+	SoftIRQ   uint64
+	Steal     uint64
+	Guest     uint64
+	GuestNice uint64
+}
+
+// Total returns the ticks of every state. Guest time is already part of
+// User and Nice, so it is left out.
+func (c CpuTimes) Total() uint64 {
+	return c.User + c.Nice + c.System + c.Idle + c.IOWait + c.IRQ + c.SoftIRQ + c.Steal
+}
+
+// KernelStat is the part of /proc/stat the agent uses.
+type KernelStat struct {
+	Cpu             CpuTimes
+	Cpus            []CpuTimes
+	BootTime        uint64
+	ContextSwitches uint64
+	Forks           uint64
+	ProcsRunning    uint64
+	ProcsBlocked    uint64
+}
+
+func ParseKernelStat(data []byte) (KernelStat, error) {
+	var kernelStat KernelStat
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		if strings.HasPrefix(fields[0], "cpu") {
+			var values [10]uint64
+			for i := 1; i < len(fields) && i <= len(values); i++ {
+				value, err := strconv.ParseUint(fields[i], 10, 64)
+				if err != nil {
+					return kernelStat, errMalformed("stat")
+				}
+				values[i-1] = value
+			}
+			cpuTimes := CpuTimes{fields[0], values[0], values[1], values[2], values[3], values[4], values[5], values[6], values[7], values[8], values[9]}
+			if fields[0] == "cpu" {
+				kernelStat.Cpu = cpuTimes
+			} else {
+				kernelStat.Cpus = append(kernelStat.Cpus, cpuTimes)
+			}
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "btime":
+			kernelStat.BootTime = value
+		case "ctxt":
+			kernelStat.ContextSwitches = value
+		case "processes":
+			kernelStat.Forks = value
+		case "procs_running":
+			kernelStat.ProcsRunning = value
+		case "procs_blocked":
+			kernelStat.ProcsBlocked = value
+		}
+	}
+
+	return kernelStat, nil
+}
+
+func (fs FS) KernelStat() (KernelStat, error) {
+	data, err := fs.readFile("stat")
+	if err != nil {
+		return KernelStat{}, err
+	}
+	return ParseKernelStat(data)
+}
+
+// ParseMeminfo parses /proc/meminfo into a map from field to value. Values
+// given in kB are converted to bytes, the others (HugePages_*) are counts.
+func ParseMeminfo(data []byte) map[string]uint64 {
+	meminfo := make(map[string]uint64)
+
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := splitStatusLine(line)
+		if !ok {
+			continue
+		}
+		if strings.HasSuffix(value, " kB") {
+			meminfo[key] = parseKb(value)
+			continue
+		}
+		if count, err := strconv.ParseUint(value, 10, 64); err == nil {
+			meminfo[key] = count
+		}
+	}
+
+	return meminfo
+}
+
+func (fs FS) Meminfo() (map[string]uint64, error) {
+	data, err := fs.readFile("meminfo")
+	if err != nil {
+		return nil, err
+	}
+	return ParseMeminfo(data), nil
+}
+
+// LoadAvg is /proc/loadavg.
+type LoadAvg struct {
+	Load1   float64
+	Load5   float64
+	Load15  float64
+	Running int
+	Total   int
+}
+
+func ParseLoadAvg(data []byte) (LoadAvg, error) {
+	var loadAvg LoadAvg
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 4 {
+		return loadAvg, errMalformed("loadavg")
+	}
+	loads := make([]float64, 3)
+	for i := range loads {
+		load, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return loadAvg, errMalformed("loadavg")
+		}
+		loads[i] = load
+	}
+	loadAvg.Load1, loadAvg.Load5, loadAvg.Load15 = loads[0], loads[1], loads[2]
+
+	running, total, found := strings.Cut(fields[3], "/")
+	if !found {
+		return loadAvg, errMalformed("loadavg")
+	}
+	loadAvg.Running, _ = strconv.Atoi(running)
+	loadAvg.Total, _ = strconv.Atoi(total)
+
+	return loadAvg, nil
+}
+
+func (fs FS) LoadAvg() (LoadAvg, error) {
+	data, err := fs.readFile("loadavg")
+	if err != nil {
+		return LoadAvg{}, err
+	}
+	return ParseLoadAvg(data)
+}
+
+// DiskStat is a line of /proc/diskstats. Sectors are 512 bytes whatever
+// the device's sector size, times are in milliseconds.
+type DiskStat struct {
+	Major           int
+	Minor           int
+	Name            string
+	ReadsCompleted  uint64
+	ReadsMerged     uint64
+	SectorsRead     uint64
+	ReadTime        uint64
+	WritesCompleted uint64
+	WritesMerged    uint64
+	SectorsWritten  uint64
+	WriteTime       uint64
+	IoInProgress    uint64
+	IoTime          uint64
+	WeightedIoTime  uint64
+}
+
+func ParseDiskStats(data []byte) ([]DiskStat, error) {
+	var diskStats []DiskStat
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 14 {
+			return diskStats, errMalformed("diskstats")
+		}
+		var values [11]uint64
+		for i := range values {
+			value, err := strconv.ParseUint(fields[3+i], 10, 64)
+			if err != nil {
+				return diskStats, errMalformed("diskstats")
+			}
+			values[i] = value
+		}
+		major, _ := strconv.Atoi(fields[0])
+		minor, _ := strconv.Atoi(fields[1])
+		diskStats = append(diskStats, DiskStat{major, minor, fields[2], values[0], values[1], values[2], values[3], values[4], values[5], values[6], values[7], values[8], values[9], values[10]})
+	}
+
+	return diskStats, nil
+}
+
+func (fs FS) DiskStats() ([]DiskStat, error) {
+	data, err := fs.readFile("diskstats")
+	if err != nil {
+		return nil, err
+	}
+	return ParseDiskStats(data)
+}
+
+// NetDev is a line of /proc/net/dev.
+type NetDev struct {
+	Name      string
+	RxBytes   uint64
+	RxPackets uint64
+	RxErrs    uint64
+	RxDrop    uint64
+	TxBytes   uint64
+	TxPackets uint64
+	TxErrs    uint64
+	TxDrop    uint64
+}
+
+func ParseNetDev(data []byte) ([]NetDev, error) {
+	var netDevs []NetDev
+
+	for _, line := range strings.Split(string(data), "\n") {
+		name, counters, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(counters)
+		if len(fields) < 16 {
+			return netDevs, errMalformed("net/dev")
+		}
+		var values [16]uint64
+		for i := range values {
+			value, err := strconv.ParseUint(fields[i], 10, 64)
+			if err != nil {
+				return netDevs, errMalformed("net/dev")
+			}
+			values[i] = value
+		}
+		netDevs = append(netDevs, NetDev{strings.TrimSpace(name), values[0], values[1], values[2], values[3], values[8], values[9], values[10], values[11]})
+	}
+
+	return netDevs, nil
+}
+
+// NetDev reads the interfaces of the network namespace of pid. /proc/net
+// is the namespace of the reader, so the host's is read through PID 1.
+func (fs FS) NetDev(pid int) ([]NetDev, error) {
+	data, err := fs.readFile(strconv.Itoa(pid), "net", "dev")
+	if err != nil {
+		return nil, err
+	}
+	return ParseNetDev(data)
+}
+
+// PressureLine is a line of a /proc/pressure file: the share of time
+// (in percent) tasks were stalled over the last 10, 60 and 300 seconds,
+// and the total stall time in microseconds.
+type PressureLine struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  uint64
+}
+
+// Pressure is a /proc/pressure file. Some is time at least one task was
+// stalled, Full time all of them were.
+type Pressure struct {
+	Some PressureLine
+	Full PressureLine
+}
+
+func ParsePressure(data []byte) (Pressure, error) {
+	var pressure Pressure
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var pressureLine PressureLine
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				return pressure, errMalformed("pressure")
+			}
+			var err error
+			switch key {
+			case "avg10":
+				pressureLine.Avg10, err = strconv.ParseFloat(value, 64)
+			case "avg60":
+				pressureLine.Avg60, err = strconv.ParseFloat(value, 64)
+			case "avg300":
+				pressureLine.Avg300, err = strconv.ParseFloat(value, 64)
+			case "total":
+				pressureLine.Total, err = strconv.ParseUint(value, 10, 64)
+			}
+			if err != nil {
+				return pressure, errMalformed("pressure")
+			}
+		}
+		switch fields[0] {
+		case "some":
+			pressure.Some = pressureLine
+		case "full":
+			pressure.Full = pressureLine
+		}
+	}
+
+	return pressure, nil
+}
+
+// Pressure reads /proc/pressure/<resource>, resource being "cpu", "memory"
+// or "io". It needs Linux 4.20 with PSI enabled.
+func (fs FS) Pressure(resource string) (Pressure, error) {
+	data, err := fs.readFile("pressure", resource)
+	if err != nil {
+		return Pressure{}, err
+	}
+	return ParsePressure(data)
+}
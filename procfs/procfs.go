@@ -0,0 +1,204 @@
+package procfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FS is a proc filesystem mounted at root, usually the host's /proc
+// mounted into the agent's container.
+type FS struct {
+	root string
+}
+
+func NewFS(root string) FS {
+	return FS{root: root}
+}
+
+// Path joins elem to the root of the filesystem.
+func (fs FS) Path(elem ...string) string {
+	return filepath.Join(append([]string{fs.root}, elem...)...)
+}
+
+// Proc is a process as read by a single pass over its /proc/[pid] files.
+// Every file is read whole and closed right away, so the Proc stays
+// consistent with itself even if the process exits halfway through.
+// Environ is not read by Proc, see FS.Environ.
+type Proc struct {
+	Pid         int
+	Stat        ProcStat
+	Status      ProcStatus
+	Cmdline     []string
+	Cwd         string
+	Exe         string
+	Environ     []string
+	Cgroups     []Cgroup
+	SmapsRollup SmapsRollup
+	IO          ProcIO
+	Namespaces  map[string]uint64
+}
+
+// CmdlineString returns the command line with its arguments joined by
+// spaces. Kernel threads have an empty command line.
+func (p Proc) CmdlineString() string {
+	return strings.Join(p.Cmdline, " ")
+}
+
+// readFile reads a /proc file whole. Files below /proc report a size of 0,
+// so os.ReadFile's size hint is useless but harmless.
+func (fs FS) readFile(elem ...string) ([]byte, error) {
+	return os.ReadFile(fs.Path(elem...))
+}
+
+// PidList returns the pids of all processes, in directory order.
+func (fs FS) PidList() ([]int, error) {
+	var pidList []int
+
+	files, err := ioutil.ReadDir(fs.root)
+	if err != nil {
+		return pidList, err
+	}
+
+	for _, file := range files {
+		pid, err := strconv.Atoi(file.Name())
+		if err != nil {
+			continue
+		}
+		pidList = append(pidList, pid)
+	}
+
+	return pidList, nil
+}
+
+// Proc reads a single process. Only stat and status are required, the
+// other files may be missing or unreadable (e.g. smaps_rollup needs
+// Linux 4.14 and ptrace access, io needs ptrace access too) and are left
+// empty then.
+func (fs FS) Proc(pid int) (Proc, error) {
+	proc, err := fs.ProcBasic(pid)
+	if err != nil {
+		return proc, err
+	}
+	pidDir := strconv.Itoa(pid)
+
+	proc.Exe, _ = os.Readlink(fs.Path(pidDir, "exe"))
+	if data, err := fs.readFile(pidDir, "smaps_rollup"); err == nil {
+		proc.SmapsRollup = ParseSmapsRollup(data)
+	}
+	if data, err := fs.readFile(pidDir, "io"); err == nil {
+		proc.IO, _ = ParseIO(data)
+	}
+	proc.Namespaces = fs.namespaces(pidDir)
+
+	return proc, nil
+}
+
+// ProcBasic reads the part of a process Proc starts with: stat, status,
+// cmdline, cwd and cgroup. It is for callers that must be quick.
+func (fs FS) ProcBasic(pid int) (Proc, error) {
+	proc := Proc{Pid: pid}
+	pidDir := strconv.Itoa(pid)
+
+	data, err := fs.readFile(pidDir, "stat")
+	if err != nil {
+		return proc, err
+	}
+	proc.Stat, err = ParseStat(data)
+	if err != nil {
+		return proc, err
+	}
+
+	data, err = fs.readFile(pidDir, "status")
+	if err != nil {
+		return proc, err
+	}
+	proc.Status, err = ParseStatus(data)
+	if err != nil {
+		return proc, err
+	}
+
+	if data, err := fs.readFile(pidDir, "cmdline"); err == nil {
+		proc.Cmdline = ParseCmdline(data)
+	}
+	// Kernel threads have neither, and other users' processes need ptrace
+	// access.
+	proc.Cwd, _ = os.Readlink(fs.Path(pidDir, "cwd"))
+	if data, err := fs.readFile(pidDir, "cgroup"); err == nil {
+		proc.Cgroups = ParseCgroups(data)
+	}
+
+	return proc, nil
+}
+
+// Environ returns the initial environment of a process as "KEY=value"
+// strings. It is left out of Proc as it is large and full of secrets.
+func (fs FS) Environ(pid int) ([]string, error) {
+	data, err := fs.readFile(strconv.Itoa(pid), "environ")
+	if err != nil {
+		return nil, err
+	}
+	return ParseCmdline(data), nil
+}
+
+// AllProcs reads every process once. Processes that exit while being read
+// are skipped.
+func (fs FS) AllProcs() ([]Proc, error) {
+	pidList, err := fs.PidList()
+	if err != nil {
+		return nil, err
+	}
+
+	procs := make([]Proc, 0, len(pidList))
+	for _, pid := range pidList {
+		proc, err := fs.Proc(pid)
+		if err != nil {
+			continue
+		}
+		procs = append(procs, proc)
+	}
+
+	return procs, nil
+}
+
+// ParseCmdline splits a NUL separated /proc/[pid]/cmdline or environ.
+func ParseCmdline(data []byte) []string {
+	cmdline := strings.TrimRight(string(data), "\x00")
+	if cmdline == "" {
+		return nil
+	}
+	return strings.Split(cmdline, "\x00")
+}
+
+// Uptime returns the seconds since boot from /proc/uptime.
+func (fs FS) Uptime() (float64, error) {
+	data, err := fs.readFile("uptime")
+	if err != nil {
+		return -1, err
+	}
+	splitData := strings.Fields(string(data))
+	if len(splitData) == 0 {
+		return -1, errMalformed("uptime")
+	}
+	return strconv.ParseFloat(splitData[0], 64)
+}
+
+// CpuCount returns the number of CPUs of the host, counted from the
+// per-cpu lines of /proc/stat.
+func (fs FS) CpuCount() (int, error) {
+	var cpuCount int
+
+	data, err := fs.readFile("stat")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "cpu") && len(line) > 3 && line[3] >= '0' && line[3] <= '9' {
+			cpuCount++
+		}
+	}
+
+	return cpuCount, nil
+}
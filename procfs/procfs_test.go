@@ -0,0 +1,96 @@
+package procfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStat(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		comm string
+		ppid int
+	}{
+		{"plain", "42 (nginx) S 1 42 42 0 -1 4194560 100 0 0 0 7 3 0 0 20 0 1 0 500 1000 25 18446744073709551615", "nginx", 1},
+		{"space", "42 (tmux: server) S 1 42 42 0 -1 4194560 100 0 0 0 7 3 0 0 20 0 1 0 500 1000 25 18446744073709551615", "tmux: server", 1},
+		{"paren", "42 (a) b (c)) R 7 42 42 0 -1 4194560 100 0 0 0 7 3 0 0 20 0 1 0 500 1000 25 18446744073709551615", "a) b (c)", 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			procStat, err := ParseStat([]byte(tt.line))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if procStat.Comm != tt.comm || procStat.PPid != tt.ppid {
+				t.Errorf("comm %q ppid %d, want %q %d", procStat.Comm, procStat.PPid, tt.comm, tt.ppid)
+			}
+			if procStat.Pid != 42 || procStat.UTime != 7 || procStat.STime != 3 || procStat.StartTime != 500 || procStat.VSize != 1000 || procStat.Rss != 25 {
+				t.Errorf("unexpected counters %+v", procStat)
+			}
+		})
+	}
+
+	if _, err := ParseStat([]byte("42 (truncated")); err == nil {
+		t.Error("expected an error for a truncated stat")
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	status := "Name:\tjava\nState:\tS (sleeping)\nTgid:\t42\nPid:\t42\nPPid:\t1\nUid:\t1000\t0\t0\t0\nGid:\t1000\t1000\t1000\t1000\nVmSize:\t 2048 kB\nVmRSS:\t  512 kB\nRssFile:\t128 kB\nVmSwap:\t0 kB\nCapEff:\t0000000000200001\nNoNewPrivs:\t1\nSeccomp:\t2\n"
+
+	procStatus, err := ParseStatus([]byte(status))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if procStatus.Name != "java" || procStatus.PPid != 1 || procStatus.Uids != [4]uint32{1000, 0, 0, 0} {
+		t.Errorf("unexpected status %+v", procStatus)
+	}
+	if procStatus.VmSize != 2048*1024 || procStatus.VmRss != 512*1024 || procStatus.RssFile != 128*1024 {
+		t.Errorf("unexpected memory %+v", procStatus)
+	}
+	if !reflect.DeepEqual(CapabilityNames(procStatus.CapEff), []string{"CAP_CHOWN", "CAP_SYS_ADMIN"}) || !procStatus.NoNewPrivs || procStatus.Seccomp != SeccompFilter {
+		t.Errorf("unexpected security %+v", procStatus)
+	}
+}
+
+func TestParseCgroups(t *testing.T) {
+	cgroups := ParseCgroups([]byte("4:cpu,cpuacct:/kubepods/pod1/abc\n1:name=systemd:/docker/abc\n0::/system.slice\n"))
+	want := []Cgroup{
+		{4, []string{"cpu", "cpuacct"}, "/kubepods/pod1/abc"},
+		{1, []string{"name=systemd"}, "/docker/abc"},
+		{0, nil, "/system.slice"},
+	}
+	if !reflect.DeepEqual(cgroups, want) {
+		t.Errorf("got %+v, want %+v", cgroups, want)
+	}
+}
+
+func TestParseIO(t *testing.T) {
+	procIO, err := ParseIO([]byte("rchar: 4096\nwchar: 512\nsyscr: 8\nsyscw: 2\nread_bytes: 8192\nwrite_bytes: 4096\ncancelled_write_bytes: 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ProcIO{RChar: 4096, WChar: 512, SyscR: 8, SyscW: 2, ReadBytes: 8192, WriteBytes: 4096}
+	if procIO != want {
+		t.Errorf("got %+v, want %+v", procIO, want)
+	}
+}
+
+func TestParseMaps(t *testing.T) {
+	mappings, err := ParseMaps([]byte("55d0c1a00000-55d0c1a02000 r-xp 00002000 fd:01 681885                     /usr/bin/cat\n7f2a40000000-7f2a40021000 rwxp 00000000 00:00 0 \n7ffd5b3f2000-7ffd5b3f4000 r-xp 00000000 00:00 0                          [vdso]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Mapping{
+		{Start: 0x55d0c1a00000, End: 0x55d0c1a02000, Perms: "r-xp", Offset: 0x2000, Inode: 681885, Path: "/usr/bin/cat"},
+		{Start: 0x7f2a40000000, End: 0x7f2a40021000, Perms: "rwxp"},
+		{Start: 0x7ffd5b3f2000, End: 0x7ffd5b3f4000, Perms: "r-xp", Path: "[vdso]"},
+	}
+	if !reflect.DeepEqual(mappings, want) {
+		t.Errorf("got %+v, want %+v", mappings, want)
+	}
+	if !mappings[1].IsExecutable() || !mappings[1].IsWritable() || mappings[0].IsWritable() {
+		t.Errorf("wrong permissions %+v", mappings)
+	}
+}
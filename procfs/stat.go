@@ -0,0 +1,79 @@
+package procfs
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func errMalformed(file string) error {
+	return fmt.Errorf("procfs: malformed %s", file)
+}
+
+// ProcStat is /proc/[pid]/stat. Tick counters are in CLK_TCK units,
+// StartTime in ticks since boot, Rss in pages.
+type ProcStat struct {
+	Pid        int
+	Comm       string
+	State      string
+	PPid       int
+	PGrp       int
+	Session    int
+	UTime      uint64
+	STime      uint64
+	CUTime     int64
+	CSTime     int64
+	NumThreads int64
+	StartTime  uint64
+	VSize      uint64
+	Rss        int64
+}
+
+// ParseStat parses /proc/[pid]/stat. comm is whatever the process put in
+// it, spaces and parentheses included, so it is taken up to the last ")"
+// rather than split on spaces.
+func ParseStat(data []byte) (ProcStat, error) {
+	var procStat ProcStat
+
+	openParen := bytes.IndexByte(data, '(')
+	closeParen := bytes.LastIndexByte(data, ')')
+	if openParen < 0 || closeParen < openParen {
+		return procStat, errMalformed("stat")
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data[:openParen])))
+	if err != nil {
+		return procStat, errMalformed("stat")
+	}
+	procStat.Pid = pid
+	procStat.Comm = string(data[openParen+1 : closeParen])
+
+	// Fields after comm, starting at field 3 (state) of proc(5).
+	fields := strings.Fields(string(data[closeParen+1:]))
+	if len(fields) < 22 {
+		return procStat, errMalformed("stat")
+	}
+
+	procStat.State = fields[0]
+	ints := []*int{&procStat.PPid, &procStat.PGrp, &procStat.Session}
+	for i, field := range ints {
+		if *field, err = strconv.Atoi(fields[1+i]); err != nil {
+			return procStat, errMalformed("stat")
+		}
+	}
+	uints := map[int]*uint64{11: &procStat.UTime, 12: &procStat.STime, 19: &procStat.StartTime, 20: &procStat.VSize}
+	for i, field := range uints {
+		if *field, err = strconv.ParseUint(fields[i], 10, 64); err != nil {
+			return procStat, errMalformed("stat")
+		}
+	}
+	int64s := map[int]*int64{13: &procStat.CUTime, 14: &procStat.CSTime, 17: &procStat.NumThreads, 21: &procStat.Rss}
+	for i, field := range int64s {
+		if *field, err = strconv.ParseInt(fields[i], 10, 64); err != nil {
+			return procStat, errMalformed("stat")
+		}
+	}
+
+	return procStat, nil
+}
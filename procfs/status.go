@@ -0,0 +1,175 @@
+package procfs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Seccomp modes of the Seccomp line of /proc/[pid]/status.
+const (
+	SeccompDisabled = 0
+	SeccompStrict   = 1
+	SeccompFilter   = 2
+)
+
+// ProcStatus is /proc/[pid]/status. Memory values are in bytes; kernel
+// threads have none and leave them at 0. Uids and Gids are the real,
+// effective, saved and filesystem IDs, in that order.
+type ProcStatus struct {
+	Name       string
+	State      string
+	Tgid       int
+	Pid        int
+	PPid       int
+	Uids       [4]uint32
+	Gids       [4]uint32
+	VmSize     uint64
+	VmRss      uint64
+	RssAnon    uint64
+	RssFile    uint64
+	RssShmem   uint64
+	VmSwap     uint64
+	Threads    int
+	CapInh     uint64
+	CapPrm     uint64
+	CapEff     uint64
+	CapBnd     uint64
+	CapAmb     uint64
+	NoNewPrivs bool
+	Seccomp    int
+}
+
+// splitStatusLine splits a "Key:\tvalue" line of a status style file.
+func splitStatusLine(line string) (string, string, bool) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return "", "", false
+	}
+	return line[:colon], strings.TrimSpace(line[colon+1:]), true
+}
+
+// parseKb parses a "1234 kB" value into bytes.
+func parseKb(value string) uint64 {
+	kb, err := strconv.ParseUint(strings.TrimSuffix(value, " kB"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return kb * 1024
+}
+
+func parseCapMask(value string) uint64 {
+	mask, err := strconv.ParseUint(value, 16, 64)
+	if err != nil {
+		return 0
+	}
+	return mask
+}
+
+func parseIds(value string) [4]uint32 {
+	var ids [4]uint32
+	for i, field := range strings.Fields(value) {
+		if i >= len(ids) {
+			break
+		}
+		id, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			continue
+		}
+		ids[i] = (uint32)(id)
+	}
+	return ids
+}
+
+// ParseStatus parses /proc/[pid]/status. Unknown keys are ignored, so new
+// kernels adding lines don't break it.
+func ParseStatus(data []byte) (ProcStatus, error) {
+	var procStatus ProcStatus
+
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := splitStatusLine(line)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Name":
+			procStatus.Name = value
+		case "State":
+			procStatus.State = value
+		case "Tgid":
+			procStatus.Tgid, _ = strconv.Atoi(value)
+		case "Pid":
+			procStatus.Pid, _ = strconv.Atoi(value)
+		case "PPid":
+			procStatus.PPid, _ = strconv.Atoi(value)
+		case "Uid":
+			procStatus.Uids = parseIds(value)
+		case "Gid":
+			procStatus.Gids = parseIds(value)
+		case "VmSize":
+			procStatus.VmSize = parseKb(value)
+		case "VmRSS":
+			procStatus.VmRss = parseKb(value)
+		case "RssAnon":
+			procStatus.RssAnon = parseKb(value)
+		case "RssFile":
+			procStatus.RssFile = parseKb(value)
+		case "RssShmem":
+			procStatus.RssShmem = parseKb(value)
+		case "VmSwap":
+			procStatus.VmSwap = parseKb(value)
+		case "Threads":
+			procStatus.Threads, _ = strconv.Atoi(value)
+		case "CapInh":
+			procStatus.CapInh = parseCapMask(value)
+		case "CapPrm":
+			procStatus.CapPrm = parseCapMask(value)
+		case "CapEff":
+			procStatus.CapEff = parseCapMask(value)
+		case "CapBnd":
+			procStatus.CapBnd = parseCapMask(value)
+		case "CapAmb":
+			procStatus.CapAmb = parseCapMask(value)
+		case "NoNewPrivs":
+			procStatus.NoNewPrivs = value == "1"
+		case "Seccomp":
+			procStatus.Seccomp, _ = strconv.Atoi(value)
+		}
+	}
+
+	if procStatus.Pid == 0 {
+		return procStatus, errMalformed("status")
+	}
+	return procStatus, nil
+}
+
+// SmapsRollup is the part of /proc/[pid]/smaps_rollup the agent uses, in
+// bytes.
+type SmapsRollup struct {
+	Rss     uint64
+	Pss     uint64
+	Swap    uint64
+	SwapPss uint64
+}
+
+func ParseSmapsRollup(data []byte) SmapsRollup {
+	var smapsRollup SmapsRollup
+
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := splitStatusLine(line)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Rss":
+			smapsRollup.Rss = parseKb(value)
+		case "Pss":
+			smapsRollup.Pss = parseKb(value)
+		case "Swap":
+			smapsRollup.Swap = parseKb(value)
+		case "SwapPss":
+			smapsRollup.SwapPss = parseKb(value)
+		}
+	}
+
+	return smapsRollup
+}
@@ -1,10 +1,11 @@
 package http
 
 type Handler struct {
+	outputDir string
 }
 
-func NewHandler() *Handler {
-	return &Handler{}
+func NewHandler(outputDir string) *Handler {
+	return &Handler{outputDir: outputDir}
 }
 
 func (h *Handler) Close() {
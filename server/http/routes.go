@@ -2,8 +2,10 @@ package http
 
 import (
 	"container-agent/job"
+	"container-agent/module"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 )
@@ -11,6 +13,14 @@ import (
 func (h *Handler) Register(e *echo.Echo) {
 	e.GET("/", h.ok)
 	e.GET("/PIDINFO", h.PID)
+	e.GET("/CONTAINERINFO", h.CONTAINER)
+	e.GET("/proctree", h.ProcTree)
+	e.GET("/namespaces", h.Namespaces)
+	e.GET("/connections", h.Connections)
+	e.GET("/events", h.Events)
+	e.GET("/node", h.Node)
+	e.GET("/findings", h.Findings)
+	e.GET("/runtimes", h.Runtimes)
 	e.GET("/PODINFO", h.POD)
 	e.GET("/Register", h.RegisterAgent)
 	// // accounts
@@ -32,18 +42,102 @@ func (h *Handler) ok(c echo.Context) error {
 	return c.String(http.StatusOK, "OK\n")
 }
 func (h *Handler) PID(c echo.Context) error {
-	pidInfo, err := ioutil.ReadFile("/dist/pidinfo")
+	pidInfo, err := ioutil.ReadFile(h.outputDir + "/pidinfo")
 	if err != nil {
 		panic(err)
-		return c.String(http.StatusOK, err.Error())
 	}
 	return c.String(http.StatusOK, string(pidInfo))
 }
+func (h *Handler) CONTAINER(c echo.Context) error {
+	containerInfo, err := ioutil.ReadFile(h.outputDir + "/containerinfo")
+	if err != nil {
+		return c.String(http.StatusOK, err.Error())
+	}
+	return c.String(http.StatusOK, string(containerInfo))
+}
+func (h *Handler) ProcTree(c echo.Context) error {
+	procTree, err := ioutil.ReadFile(h.outputDir + "/proctree")
+	if err != nil {
+		return c.String(http.StatusOK, err.Error())
+	}
+	if container := c.QueryParam("container"); container != "" {
+		filtered, err := module.FilterProcTree(procTree, container)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		return c.String(http.StatusOK, filtered)
+	}
+	return c.String(http.StatusOK, string(procTree))
+}
+func (h *Handler) Namespaces(c echo.Context) error {
+	namespaceInfo, err := ioutil.ReadFile(h.outputDir + "/namespaces")
+	if err != nil {
+		return c.String(http.StatusOK, err.Error())
+	}
+	return c.String(http.StatusOK, string(namespaceInfo))
+}
+func (h *Handler) Connections(c echo.Context) error {
+	connectionInfo, err := ioutil.ReadFile(h.outputDir + "/connections")
+	if err != nil {
+		return c.String(http.StatusOK, err.Error())
+	}
+	return c.String(http.StatusOK, string(connectionInfo))
+}
+func (h *Handler) Events(c echo.Context) error {
+	events, err := ioutil.ReadFile(h.outputDir + "/events")
+	if err != nil {
+		return c.String(http.StatusOK, err.Error())
+	}
+
+	var since uint64
+	if param := c.QueryParam("since"); param != "" {
+		since, err = strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			return c.String(http.StatusBadRequest, "invalid since: "+param)
+		}
+	}
+	limit := module.DefaultEventLimit
+	if param := c.QueryParam("limit"); param != "" {
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit <= 0 {
+			return c.String(http.StatusBadRequest, "invalid limit: "+param)
+		}
+		if limit > module.MaxEventLimit {
+			limit = module.MaxEventLimit
+		}
+	}
+
+	page, err := module.FilterEvents(events, since, limit)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.String(http.StatusOK, page)
+}
+func (h *Handler) Node(c echo.Context) error {
+	nodeInfo, err := ioutil.ReadFile(h.outputDir + "/node")
+	if err != nil {
+		return c.String(http.StatusOK, err.Error())
+	}
+	return c.String(http.StatusOK, string(nodeInfo))
+}
+func (h *Handler) Findings(c echo.Context) error {
+	findings, err := ioutil.ReadFile(h.outputDir + "/findings")
+	if err != nil {
+		return c.String(http.StatusOK, err.Error())
+	}
+	return c.String(http.StatusOK, string(findings))
+}
+func (h *Handler) Runtimes(c echo.Context) error {
+	runtimes, err := ioutil.ReadFile(h.outputDir + "/runtimes")
+	if err != nil {
+		return c.String(http.StatusOK, err.Error())
+	}
+	return c.String(http.StatusOK, string(runtimes))
+}
 func (h *Handler) POD(c echo.Context) error {
-	podInfo, err := ioutil.ReadFile("/dist/podinfo")
+	podInfo, err := ioutil.ReadFile(h.outputDir + "/podinfo")
 	if err != nil {
 		panic(err)
-		return c.String(http.StatusOK, err.Error())
 	}
 	return c.String(http.StatusOK, string(podInfo))
 }
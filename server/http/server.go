@@ -18,7 +18,7 @@ type Server struct {
 	h *Handler
 }
 
-func Start(listenPort uint16, logLevel log.Lvl) (*Server, error) {
+func Start(listenPort uint16, outputDir string, logLevel log.Lvl) (*Server, error) {
 	s := &Server{}
 
 	s.e = newEcho(logLevel)
@@ -26,7 +26,7 @@ func Start(listenPort uint16, logLevel log.Lvl) (*Server, error) {
 		return nil, fmt.Errorf("failed to create new echo")
 	}
 
-	s.h = NewHandler()
+	s.h = NewHandler(outputDir)
 	if s.h == nil {
 		return nil, fmt.Errorf("failed to create new handler")
 	}